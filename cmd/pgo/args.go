@@ -0,0 +1,269 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/newmizanur/poly-go/polygo"
+)
+
+// pathFlags are go flags whose value is a file or directory. go runs inside
+// .pgo_gen, so their values are made absolute against the user's working
+// directory; otherwise outputs would land in the generated tree.
+var pathFlags = map[string]bool{
+	"-o":            true,
+	"-coverprofile": true,
+	"-cpuprofile":   true,
+	"-memprofile":   true,
+	"-blockprofile": true,
+	"-mutexprofile": true,
+	"-trace":        true,
+	"-outputdir":    true,
+	"-modfile":      true,
+	"-overlay":      true,
+	"-pkgdir":       true,
+}
+
+// valueFlags are the other go flags that take a value, so that the value is
+// not mistaken for a package.
+var valueFlags = map[string]bool{
+	"-asmflags": true, "-buildmode": true, "-compiler": true, "-gccgoflags": true,
+	"-gcflags": true, "-installsuffix": true, "-ldflags": true, "-mod": true,
+	"-p": true, "-pgo": true, "-tags": true, "-toolexec": true, "-exec": true,
+	"-C": true, "-covermode": true, "-coverpkg": true, "-f": true,
+	"-run": true, "-bench": true, "-skip": true, "-fuzz": true, "-list": true,
+	"-count": true, "-cpu": true, "-parallel": true, "-timeout": true,
+	"-benchtime": true, "-fuzztime": true, "-fuzzminimizetime": true,
+	"-shuffle": true, "-vet": true,
+}
+
+// mapArgsForGenerated rewrites go arguments for a go command running in the
+// mirror of the user's working directory inside the generated workspace of
+// moduleRoot (see generatedWorkDir). Relative package patterns therefore keep
+// their meaning; only these change:
+//   - values of path flags become absolute,
+//   - .p.go files are replaced by the Go files generated from them,
+//   - absolute paths inside the module point into the workspace.
+//
+// Program arguments (after the package of go run, or after -args) are kept.
+func mapArgsForGenerated(subcmd string, args []string, maps polygo.Maps, moduleRoot string) []string {
+	out := make([]string, 0, len(args))
+	sawFiles := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-args" || arg == "--args" || arg == "--" {
+			return append(out, args[i:]...)
+		}
+		if strings.HasPrefix(arg, "-") {
+			name, value, hasValue := strings.Cut(arg, "=")
+			flagName := "-" + strings.TrimPrefix(strings.TrimLeft(name, "-"), "test.")
+			switch {
+			case valueFlags[flagName] && !hasValue && i+1 < len(args):
+				out = append(out, arg, args[i+1])
+				i++
+			case !pathFlags[flagName] || flagName == "-o" && subcmd == "run":
+				out = append(out, arg)
+			case hasValue:
+				out = append(out, name+"="+absPath(value))
+			case i+1 < len(args):
+				out = append(out, arg, absPath(args[i+1]))
+				i++
+			default:
+				out = append(out, arg)
+			}
+			continue
+		}
+		if subcmd == "run" {
+			// go run takes .go files or one package; the rest belongs to the
+			// program.
+			isFile := strings.HasSuffix(arg, ".go")
+			if sawFiles && !isFile {
+				return append(out, args[i:]...)
+			}
+			out = append(out, generatedPackageArg(arg, moduleRoot, maps))
+			if !isFile {
+				return append(out, args[i+1:]...)
+			}
+			sawFiles = true
+			continue
+		}
+		out = append(out, generatedPackageArg(arg, moduleRoot, maps))
+	}
+	return out
+}
+
+// generatedPackageArg maps a package pattern or file path to its counterpart
+// in the generated workspace. Relative patterns and import paths are kept.
+func generatedPackageArg(arg, moduleRoot string, maps polygo.Maps) string {
+	if strings.HasSuffix(arg, ".go") {
+		arg = polygo.GoFileName(arg, maps)
+	}
+	if !filepath.IsAbs(arg) {
+		return arg
+	}
+	rel, err := filepath.Rel(moduleRoot, arg)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return arg
+	}
+	return filepath.Join(moduleRoot, polygo.GeneratedDirName, rel)
+}
+
+// generatedWorkDir returns the directory of the generated workspace that
+// mirrors the user's working directory, creating it if the mirror has no
+// files. Outside the module tree it is the workspace root.
+func generatedWorkDir(moduleRoot string) (string, error) {
+	genDir := filepath.Join(moduleRoot, polygo.GeneratedDirName)
+	rel, err := filepath.Rel(moduleRoot, mustGetwd())
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) ||
+		rel == polygo.GeneratedDirName || strings.HasPrefix(rel, polygo.GeneratedDirName+string(filepath.Separator)) {
+		return genDir, nil
+	}
+	dir := filepath.Join(genDir, rel)
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// absPath resolves path against the working directory. A trailing separator
+// is kept: for -o it means "write into this directory".
+func absPath(path string) string {
+	if filepath.IsAbs(path) || path == "" {
+		return path
+	}
+	abs := filepath.Join(mustGetwd(), path)
+	if strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(filepath.Separator)) {
+		abs += string(filepath.Separator)
+	}
+	return abs
+}
+
+// hasFlag reports whether args set the go flag name (-name or --name, with
+// or without =value).
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "-args" || arg == "--" {
+			return false
+		}
+		flagName, _, _ := strings.Cut(arg, "=")
+		if "-"+strings.TrimLeft(flagName, "-") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// modFlagValue returns the -mod flag the go command will see for args: the
+// last one in args, or else the one in GOFLAGS.
+func modFlagValue(args []string) string {
+	value := ""
+	for _, field := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if v, ok := strings.CutPrefix("-"+strings.TrimLeft(field, "-"), "-mod="); ok {
+			value = v
+		}
+	}
+	for i, arg := range args {
+		if arg == "-args" || arg == "--" {
+			break
+		}
+		flagName, v, hasValue := strings.Cut(arg, "=")
+		if "-"+strings.TrimLeft(flagName, "-") != "-mod" {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			v = args[i+1]
+		}
+		value = v
+	}
+	return value
+}
+
+// buildOutputName returns the file go build writes in dir when run without
+// -o on args: the binary of the one package built, named after the first
+// .go file, the last element of the import path or module path, or the
+// directory. It is empty when go build writes nothing there, as for several
+// packages.
+func buildOutputName(args []string, dir string) string {
+	var pkgs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			name, _, hasValue := strings.Cut(arg, "=")
+			flagName := "-" + strings.TrimLeft(name, "-")
+			if !hasValue && (valueFlags[flagName] || pathFlags[flagName]) {
+				i++
+			}
+			continue
+		}
+		pkgs = append(pkgs, arg)
+	}
+
+	name := ""
+	switch {
+	case len(pkgs) > 0 && strings.HasSuffix(pkgs[0], ".go"):
+		name = strings.TrimSuffix(filepath.Base(pkgs[0]), ".go")
+	case len(pkgs) > 1 || len(pkgs) == 1 && strings.Contains(pkgs[0], "..."):
+		return ""
+	case len(pkgs) == 1 && !filepath.IsAbs(pkgs[0]) && !strings.HasPrefix(pkgs[0], "."):
+		name = execName(pkgs[0])
+	default:
+		pkgDir := dir
+		if len(pkgs) == 1 {
+			pkgDir = pkgs[0]
+			if !filepath.IsAbs(pkgDir) {
+				pkgDir = filepath.Join(dir, pkgDir)
+			}
+		}
+		// The module root may be .pgo_gen or a mirror of another name; go
+		// names its binary after the module path.
+		if data, err := os.ReadFile(filepath.Join(pkgDir, "go.mod")); err == nil {
+			if mod := polygo.ModulePath(data); mod != "" {
+				name = execName(mod)
+				break
+			}
+		}
+		name = filepath.Base(pkgDir)
+	}
+	goos := os.Getenv("GOOS")
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// execName returns the last element of an import path, skipping a major
+// version suffix as go build does: example.com/tool/v2 builds tool.
+func execName(importPath string) string {
+	elem := path.Base(importPath)
+	if dir := path.Dir(importPath); dir != "." && len(elem) > 1 && elem[0] == 'v' && strings.Trim(elem[1:], "0123456789") == "" {
+		return path.Base(dir)
+	}
+	return elem
+}
+
+// moveOutput runs cmd and moves the file name in dir to destDir if cmd
+// creates or rewrites it. Other files are left alone, so nothing of the
+// user's is overwritten but the binary go build would have written there.
+func moveOutput(cmd *exec.Cmd, dir, name, destDir string) error {
+	if name == "" {
+		return cmd.Run()
+	}
+	src := filepath.Join(dir, name)
+	var before time.Time
+	if info, err := os.Stat(src); err == nil {
+		before = info.ModTime()
+	}
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	info, err := os.Stat(src)
+	if err != nil || !info.Mode().IsRegular() || info.ModTime().Equal(before) {
+		return nil
+	}
+	return os.Rename(src, filepath.Join(destDir, name))
+}
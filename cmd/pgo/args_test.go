@@ -0,0 +1,216 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/newmizanur/poly-go/polygo"
+)
+
+func TestBuildOutputName(t *testing.T) {
+	t.Setenv("GOOS", runtime.GOOS)
+	dir := filepath.Join(t.TempDir(), polygo.GeneratedDirName)
+	if err := os.MkdirAll(filepath.Join(dir, "cmd", "tool"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app/v2 // app\n\ngo 1.21\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "app"},
+		{[]string{"."}, "app"},
+		{[]string{"-tags", "x", "-ldflags=-s", "-v"}, "app"},
+		{[]string{"./cmd/tool"}, "tool"},
+		{[]string{"-C", "cmd", "./cmd/tool"}, "tool"},
+		{[]string{filepath.Join(dir, "cmd", "tool")}, "tool"},
+		{[]string{"example.com/other/cmd/x"}, "x"},
+		{[]string{"example.com/other/v3"}, "other"},
+		{[]string{"main_p.go", "util.go"}, "main_p"},
+		{[]string{"./..."}, ""},
+		{[]string{"./cmd/tool", "."}, ""},
+	}
+	for _, tt := range tests {
+		if got := buildOutputName(tt.args, dir); got != tt.want && !(runtime.GOOS == "windows" && got == tt.want+".exe") {
+			t.Errorf("buildOutputName(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	t.Setenv("GOOS", "windows")
+	if got := buildOutputName(nil, dir); got != "app.exe" {
+		t.Errorf("buildOutputName for windows = %q, want app.exe", got)
+	}
+}
+
+func TestMapArgsForGenerated(t *testing.T) {
+	maps, err := polygo.EmbeddedMaps("es", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(string(filepath.Separator), "src", "app")
+	gen := filepath.Join(root, polygo.GeneratedDirName)
+	abs := func(path string) string { return filepath.Join(wd, path) }
+
+	tests := []struct {
+		subcmd string
+		args   []string
+		want   []string
+	}{
+		// Path flags become absolute, with = or a separate value.
+		{"build", []string{"-o", "bin/app", "."}, []string{"-o", abs("bin/app"), "."}},
+		{"build", []string{"-o=bin/app", "."}, []string{"-o=" + abs("bin/app"), "."}},
+		{"build", []string{"--o=bin/", "."}, []string{"--o=" + abs("bin") + string(filepath.Separator), "."}},
+		{"test", []string{"-coverprofile", "c.out", "./..."}, []string{"-coverprofile", abs("c.out"), "./..."}},
+		{"test", []string{"-coverprofile=c.out"}, []string{"-coverprofile=" + abs("c.out")}},
+		{"test", []string{"-test.coverprofile=c.out"}, []string{"-test.coverprofile=" + abs("c.out")}},
+		{"build", []string{"-o", "/tmp/app"}, []string{"-o", "/tmp/app"}},
+		// Values of other flags are not packages.
+		{"build", []string{"-tags", "main.p.go", "-ldflags", "-s -w", "."}, []string{"-tags", "main.p.go", "-ldflags", "-s -w", "."}},
+		{"test", []string{"-run", "TestX", "-count", "1", "./pkg"}, []string{"-run", "TestX", "-count", "1", "./pkg"}},
+		{"build", []string{"-mod=vendor", "-v", "./..."}, []string{"-mod=vendor", "-v", "./..."}},
+		// .p.go files map to their generated names.
+		{"build", []string{"main.p.go", "util.go"}, []string{"main_p.go", "util.go"}},
+		{"vet", []string{"x_linux.p.go"}, []string{"x_p_linux.go"}},
+		{"build", []string{filepath.Join(root, "cmd", "main.p.go")}, []string{filepath.Join(gen, "cmd", "main_p.go")}},
+		{"build", []string{filepath.Join(root, "pkg")}, []string{filepath.Join(gen, "pkg")}},
+		{"build", []string{"/elsewhere/pkg"}, []string{"/elsewhere/pkg"}},
+		{"build", []string{"example.com/app/pkg"}, []string{"example.com/app/pkg"}},
+		// Program arguments of go run stay as they are.
+		{"run", []string{".", "in.p.go", "-o", "out"}, []string{".", "in.p.go", "-o", "out"}},
+		{"run", []string{"main.p.go", "util.p.go", "arg.p.go.txt", "x.p.go"}, []string{"main_p.go", "util_p.go", "arg.p.go.txt", "x.p.go"}},
+		{"run", []string{"-race", "./cmd/tool", "-v"}, []string{"-race", "./cmd/tool", "-v"}},
+		// So do the arguments after -args.
+		{"test", []string{"./pkg", "-args", "-o", "x.p.go"}, []string{"./pkg", "-args", "-o", "x.p.go"}},
+		{"test", []string{"--", "a.p.go"}, []string{"--", "a.p.go"}},
+		// A trailing value flag without a value is kept.
+		{"build", []string{"-o"}, []string{"-o"}},
+	}
+	for _, tt := range tests {
+		got := mapArgsForGenerated(tt.subcmd, tt.args, maps, root)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mapArgsForGenerated(%s, %q) = %q, want %q", tt.subcmd, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestAbsPath(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sep := string(filepath.Separator)
+	tests := map[string]string{
+		"":            "",
+		"c.out":       filepath.Join(wd, "c.out"),
+		"out/":        filepath.Join(wd, "out") + sep,
+		"../x":        filepath.Join(filepath.Dir(wd), "x"),
+		sep + "abs":   sep + "abs",
+		sep + "abs/":  sep + "abs/",
+		"a/./b/../c/": filepath.Join(wd, "a", "c") + sep,
+	}
+	for in, want := range tests {
+		if got := absPath(in); got != want {
+			t.Errorf("absPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGeneratedWorkDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := filepath.Join(root, polygo.GeneratedDirName)
+	tests := []struct {
+		cwd  string
+		want string
+	}{
+		{root, gen},
+		{filepath.Join(root, "cmd", "tool"), filepath.Join(gen, "cmd", "tool")},
+		{outside, gen},
+		{gen, gen},
+		{filepath.Join(gen, "cmd"), gen},
+	}
+	for _, tt := range tests {
+		if err := os.MkdirAll(tt.cwd, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(tt.cwd); err != nil {
+			t.Fatal(err)
+		}
+		got, err := generatedWorkDir(root)
+		if err != nil {
+			t.Fatalf("generatedWorkDir from %s: %v", tt.cwd, err)
+		}
+		if got != tt.want {
+			t.Errorf("generatedWorkDir from %s = %s, want %s", tt.cwd, got, tt.want)
+		}
+	}
+	// The mirror of a subdirectory is created for the go command to run in.
+	if info, err := os.Stat(filepath.Join(gen, "cmd", "tool")); err != nil || !info.IsDir() {
+		t.Errorf("generatedWorkDir did not create the mirrored directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(gen, filepath.Base(outside))); !os.IsNotExist(err) {
+		t.Errorf("generatedWorkDir created a directory for a path outside the module: %v", err)
+	}
+}
+
+func TestHasFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		name string
+		want bool
+	}{
+		{[]string{"-o", "x"}, "-o", true},
+		{[]string{"--o=x"}, "-o", true},
+		{[]string{"-ldflags=-o x"}, "-o", false},
+		{[]string{"-v", "./..."}, "-o", false},
+		{[]string{"./pkg", "-args", "-o", "x"}, "-o", false},
+		{[]string{"--", "-o"}, "-o", false},
+	}
+	for _, tt := range tests {
+		if got := hasFlag(tt.args, tt.name); got != tt.want {
+			t.Errorf("hasFlag(%q, %s) = %v, want %v", tt.args, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestModFlagValue(t *testing.T) {
+	tests := []struct {
+		goflags string
+		args    []string
+		want    string
+	}{
+		{"", nil, ""},
+		{"-mod=vendor", nil, "vendor"},
+		{"--mod=readonly -v", []string{"-v"}, "readonly"},
+		{"-mod=vendor", []string{"-mod=mod"}, "mod"},
+		{"", []string{"-mod", "vendor", "."}, "vendor"},
+		{"", []string{"--mod=readonly", "-mod=vendor"}, "vendor"},
+		{"", []string{".", "-args", "-mod=vendor"}, ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("GOFLAGS", tt.goflags)
+		if got := modFlagValue(tt.args); got != tt.want {
+			t.Errorf("modFlagValue(%q) with GOFLAGS=%q = %q, want %q", tt.args, tt.goflags, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/newmizanur/poly-go/polygo"
+)
+
+// coverProfileArg finds the -coverprofile flag of go test arguments. It
+// returns the index of the argument holding the path and the path itself.
+func coverProfileArg(args []string) (int, string) {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch "-" + strings.TrimLeft(name, "-") {
+		case "-coverprofile", "-test.coverprofile":
+			if hasValue {
+				return i, value
+			}
+			if i+1 < len(args) {
+				return i + 1, args[i+1]
+			}
+		}
+	}
+	return -1, ""
+}
+
+// rewriteCoverProfile points a profile written by go test at the .p.go
+// sources.
+func rewriteCoverProfile(moduleRoot, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err = polygo.CoverProfileToSource(moduleRoot, data)
+	if err != nil {
+		return fmt.Errorf("rewrite coverage profile %s: %w", path, err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// coverArgs makes the paths in go tool cover arguments absolute, in place.
+// It reports whether they ask for -html, and which argument holds the
+// profile: -func=c.out (profileFlag is then "-func"), or the value after
+// -func or -html (profileFlag is empty). profileIdx is -1 without one.
+func coverArgs(args []string) (html bool, profileIdx int, profileFlag string) {
+	profileIdx = -1
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		switch flagName := "-" + strings.TrimLeft(name, "-"); flagName {
+		case "-html", "-func", "-o":
+			html = html || flagName == "-html"
+			if hasValue {
+				args[i] = name + "=" + absPath(value)
+				if flagName != "-o" {
+					profileIdx, profileFlag = i, name
+				}
+			} else if i+1 < len(args) {
+				args[i+1] = absPath(args[i+1])
+				if flagName != "-o" {
+					profileIdx, profileFlag = i+1, ""
+				}
+				i++
+			}
+		}
+	}
+	return html, profileIdx, profileFlag
+}
+
+// runCover runs go tool cover on a profile written by pgo test. -html reads
+// the localized sources from the user's tree; every other mode needs Go
+// sources, so the profile is mapped back to the generated workspace and the
+// output is rewritten into the localized spelling.
+func runCover(args []string) error {
+	moduleRoot, err := polygo.FindRoot(mustGetwd())
+	if err != nil {
+		return err
+	}
+	args = append([]string(nil), args...)
+	html, profileIdx, profileFlag := coverArgs(args)
+
+	cmd := exec.Command("go", append([]string{"tool", "cover"}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if html || profileIdx < 0 {
+		return cmd.Run()
+	}
+
+	profile := args[profileIdx]
+	if profileFlag != "" {
+		profile = strings.TrimPrefix(profile, profileFlag+"=")
+	}
+	data, err := os.ReadFile(profile)
+	if err != nil {
+		return err
+	}
+	data, err = polygo.CoverProfileToGenerated(moduleRoot, data)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "pgo-cover-*.out")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	args[profileIdx] = tmp.Name()
+	if profileFlag != "" {
+		args[profileIdx] = profileFlag + "=" + tmp.Name()
+	}
+
+	names, err := polygo.LoadNames(moduleRoot)
+	if err != nil {
+		return err
+	}
+	replacer := names.Replacer()
+	stdout := newLineRewriter(os.Stdout, replacer)
+	stderr := newLineRewriter(os.Stderr, replacer)
+	cmd.Args = append([]string{"go", "tool", "cover"}, args...)
+	cmd.Dir = filepath.Join(moduleRoot, polygo.GeneratedDirName)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	runErr := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+	return runErr
+}
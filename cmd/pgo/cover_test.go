@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCoverArgs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs := func(path string) string { return filepath.Join(wd, path) }
+	tests := []struct {
+		args        []string
+		want        []string
+		html        bool
+		profileIdx  int
+		profileFlag string
+	}{
+		{[]string{"-func=c.out"}, []string{"-func=" + abs("c.out")}, false, 0, "-func"},
+		{[]string{"-func", "c.out"}, []string{"-func", abs("c.out")}, false, 1, ""},
+		{[]string{"--func", "c.out", "-o", "f.txt"}, []string{"--func", abs("c.out"), "-o", abs("f.txt")}, false, 1, ""},
+		{[]string{"-o=f.txt", "-func=c.out"}, []string{"-o=" + abs("f.txt"), "-func=" + abs("c.out")}, false, 1, "-func"},
+		{[]string{"-html", "c.out", "-o", "c.html"}, []string{"-html", abs("c.out"), "-o", abs("c.html")}, true, 1, ""},
+		{[]string{"-html=c.out"}, []string{"-html=" + abs("c.out")}, true, 0, "-html"},
+		{[]string{"-o", "-func"}, []string{"-o", abs("-func")}, false, -1, ""},
+		{[]string{"-func"}, []string{"-func"}, false, -1, ""},
+	}
+	for _, tt := range tests {
+		args := append([]string(nil), tt.args...)
+		html, idx, flag := coverArgs(args)
+		if !reflect.DeepEqual(args, tt.want) || html != tt.html || idx != tt.profileIdx || flag != tt.profileFlag {
+			t.Errorf("coverArgs(%q) = %q, %v, %d, %q; want %q, %v, %d, %q",
+				tt.args, args, html, idx, flag, tt.want, tt.html, tt.profileIdx, tt.profileFlag)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/newmizanur/poly-go/polygo"
+)
+
+// debugSession describes a headless debug server for editor clients. Its
+// substitutePath entries use the vscode-go convention: "from" is the path
+// the editor shows, "to" the path in the debug info.
+type debugSession struct {
+	Listen         string           `json:"listen"`
+	Program        string           `json:"program"`
+	Cwd            string           `json:"cwd"`
+	SubstitutePath []substitutePath `json:"substitutePath"`
+}
+
+type substitutePath struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// runDebug builds a package of the generated workspace without optimizations
+// and starts Delve on it. Transpiled files carry /*line*/ directives naming
+// their .p.go sources, so breakpoints and listings use the localized files;
+// copied .go files are mapped from .pgo_gen back to the module with
+// substitute-path.
+//
+// With --listen, Delve runs headless (JSON-RPC and DAP) and a JSON line
+// describing the session is printed for editor clients.
+func runDebug(args []string, lang, mapPath string, allowGo bool) error {
+	parsed, err := parseDebugArgs(args)
+	if err != nil {
+		return err
+	}
+
+	dlv, err := exec.LookPath("dlv")
+	if err != nil {
+		return fmt.Errorf("dlv not found in PATH; install it with: go install github.com/go-delve/delve/cmd/dlv@latest")
+	}
+
+	moduleRoot, err := polygo.FindRoot(mustGetwd())
+	if err != nil {
+		return err
+	}
+	maps, resolvedLang, err := polygo.ModuleMaps(moduleRoot, lang, mapPath, allowGo)
+	if err != nil {
+		return err
+	}
+	opts := generateOptions(resolvedLang)
+	opts.LineDirectives = true
+	if err := polygo.Generate(moduleRoot, maps, opts); err != nil {
+		return err
+	}
+	genDir := filepath.Join(moduleRoot, polygo.GeneratedDirName)
+
+	tmpDir, err := os.MkdirTemp("", "pgo-debug-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	bin := filepath.Join(tmpDir, "__debug_bin")
+	build := exec.Command("go", append([]string{"build", "-gcflags=all=-N -l", "-o", bin}, mapArgsForGenerated("build", []string{parsed.pkg}, maps, moduleRoot)...)...)
+	build.Dir, err = generatedWorkDir(moduleRoot)
+	if err != nil {
+		return err
+	}
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		return err
+	}
+
+	dlvArgs := []string{"exec", bin, "--wd", mustGetwd()}
+	if parsed.listen != "" {
+		dlvArgs = append(dlvArgs, "--headless", "--listen="+parsed.listen, "--api-version=2", "--accept-multiclient")
+		session, err := json.Marshal(newDebugSession(parsed.listen, bin, mustGetwd(), moduleRoot, genDir))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, string(session))
+	} else {
+		initFile := filepath.Join(tmpDir, "init")
+		if err := os.WriteFile(initFile, []byte(debugInitScript(moduleRoot, genDir)), 0o644); err != nil {
+			return err
+		}
+		dlvArgs = append(dlvArgs, "--init", initFile)
+	}
+	if len(parsed.progArgs) > 0 {
+		dlvArgs = append(append(dlvArgs, "--"), parsed.progArgs...)
+	}
+	cmd := exec.Command(dlv, dlvArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// debugArgs are the arguments of pgo debug left after the common flags.
+type debugArgs struct {
+	listen   string
+	pkg      string
+	progArgs []string
+}
+
+func parseDebugArgs(args []string) (debugArgs, error) {
+	var d debugArgs
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			d.progArgs = args[i+1:]
+			i = len(args)
+		case strings.HasPrefix(arg, "--listen="):
+			d.listen = strings.TrimPrefix(arg, "--listen=")
+		case arg == "--listen":
+			if i+1 >= len(args) {
+				return d, fmt.Errorf("missing value for --listen")
+			}
+			d.listen = args[i+1]
+			i++
+		case d.pkg == "" && !strings.HasPrefix(arg, "-"):
+			d.pkg = arg
+		default:
+			return d, fmt.Errorf("usage: pgo debug [--lang=<locale>] [--listen=<addr>] [package|file.p.go] [-- args...]")
+		}
+	}
+	if d.pkg == "" {
+		d.pkg = "."
+	}
+	return d, nil
+}
+
+// newDebugSession describes a headless session. The editor shows the
+// module's files; the debug info names the copies in genDir.
+func newDebugSession(listen, program, cwd, moduleRoot, genDir string) debugSession {
+	return debugSession{
+		Listen:         listen,
+		Program:        program,
+		Cwd:            cwd,
+		SubstitutePath: []substitutePath{{From: moduleRoot, To: genDir}},
+	}
+}
+
+// debugInitScript maps genDir, as named in the debug info, to the module for
+// Delve's terminal client.
+func debugInitScript(moduleRoot, genDir string) string {
+	return "config substitute-path " + quoteDlvWord(genDir) + " " + quoteDlvWord(moduleRoot) + "\n"
+}
+
+// quoteDlvWord quotes s for a Delve command line, which splits on white space
+// outside "" and takes a backslash inside them as an escape.
+func quoteDlvWord(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
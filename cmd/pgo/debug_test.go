@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseDebugArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want debugArgs
+		err  bool
+	}{
+		{nil, debugArgs{pkg: "."}, false},
+		{[]string{"./cmd/tool"}, debugArgs{pkg: "./cmd/tool"}, false},
+		{[]string{"main.p.go"}, debugArgs{pkg: "main.p.go"}, false},
+		{[]string{"--listen=127.0.0.1:2345"}, debugArgs{listen: "127.0.0.1:2345", pkg: "."}, false},
+		{[]string{"--listen", ":2345", "./cmd/tool"}, debugArgs{listen: ":2345", pkg: "./cmd/tool"}, false},
+		{[]string{".", "--", "-v", "--listen=x", "in.p.go"}, debugArgs{pkg: ".", progArgs: []string{"-v", "--listen=x", "in.p.go"}}, false},
+		{[]string{"--"}, debugArgs{pkg: ".", progArgs: []string{}}, false},
+		{[]string{"--listen"}, debugArgs{}, true},
+		{[]string{"-v"}, debugArgs{}, true},
+		{[]string{"./a", "./b"}, debugArgs{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDebugArgs(tt.args)
+		if (err != nil) != tt.err {
+			t.Errorf("parseDebugArgs(%q) error %v, want error %v", tt.args, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDebugArgs(%q) = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestDebugSession(t *testing.T) {
+	session := newDebugSession("127.0.0.1:2345", "/tmp/pgo-debug-1/__debug_bin", "/src/app/cmd", "/src/app", "/src/app/.pgo_gen")
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Editors map the path they show (the module) to the path in the debug
+	// info (the generated workspace).
+	want := `{"listen":"127.0.0.1:2345","program":"/tmp/pgo-debug-1/__debug_bin","cwd":"/src/app/cmd","substitutePath":[{"from":"/src/app","to":"/src/app/.pgo_gen"}]}`
+	if string(data) != want {
+		t.Errorf("session JSON:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestDebugInitScript(t *testing.T) {
+	tests := []struct {
+		moduleRoot, genDir, want string
+	}{
+		{"/src/app", "/src/app/.pgo_gen", "config substitute-path \"/src/app/.pgo_gen\" \"/src/app\"\n"},
+		{"/my app", "/my app/.pgo_gen", "config substitute-path \"/my app/.pgo_gen\" \"/my app\"\n"},
+		{`/it's "x"`, `/it's "x"/.pgo_gen`, `config substitute-path "/it's \"x\"/.pgo_gen" "/it's \"x\""` + "\n"},
+		{`C:\src\app`, `C:\src\app\.pgo_gen`, `config substitute-path "C:\\src\\app\\.pgo_gen" "C:\\src\\app"` + "\n"},
+	}
+	for _, tt := range tests {
+		if got := debugInitScript(tt.moduleRoot, tt.genDir); got != tt.want {
+			t.Errorf("debugInitScript(%q, %q) = %q, want %q", tt.moduleRoot, tt.genDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Binaries started by go run/test are routed through "pgo __exec" so they
+// run in the user's tree instead of .pgo_gen: relative reads see the real
+// files and writes survive the next Generate.
+const (
+	execCommand  = "__exec"
+	envGenDir    = "PGO_GEN_DIR"
+	envOriginDir = "PGO_ORIGIN_DIR"
+)
+
+// originExecFlag returns the -exec flag for go run/test, or "" when the user
+// already passed their own -exec.
+func originExecFlag(args []string) (string, error) {
+	for _, arg := range args {
+		if arg == "-exec" || arg == "--exec" || strings.HasPrefix(arg, "-exec=") || strings.HasPrefix(arg, "--exec=") {
+			return "", nil
+		}
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return execFlag(self)
+}
+
+// execFlag returns the -exec flag running self as "pgo __exec".
+func execFlag(self string) (string, error) {
+	word, ok := quoteExecWord(self)
+	if !ok {
+		return "", fmt.Errorf("cannot pass %q to go -exec: it has white space and both kinds of quotes", self)
+	}
+	return "-exec=" + word + " " + execCommand, nil
+}
+
+// quoteExecWord quotes s the way go's -exec flag splits its words: on white
+// space, with a word wholly in single or double quotes taken as is. There is
+// no escaping, so a word with white space and both kinds of quotes cannot be
+// written.
+func quoteExecWord(s string) (string, bool) {
+	if s != "" && !strings.ContainsAny(s, " \t\n\r") && s[0] != '\'' && s[0] != '"' {
+		return s, true
+	}
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'", true
+	}
+	if !strings.Contains(s, `"`) {
+		return `"` + s + `"`, true
+	}
+	return "", false
+}
+
+func originEnv(genDir, originDir string) []string {
+	return []string{envGenDir + "=" + genDir, envOriginDir + "=" + originDir}
+}
+
+// runInOrigin runs a binary built in the generated workspace from the
+// matching directory of the user's tree.
+func runInOrigin(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: pgo %s <binary> [args...]", execCommand)
+	}
+	dir := mustGetwd()
+	genDir, originDir := os.Getenv(envGenDir), os.Getenv(envOriginDir)
+	if genDir != "" && originDir != "" {
+		if rel, err := filepath.Rel(genDir, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			if info, err := os.Stat(filepath.Join(originDir, rel)); err == nil && info.IsDir() {
+				dir = filepath.Join(originDir, rel)
+			}
+		}
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	return cmd.Run()
+}
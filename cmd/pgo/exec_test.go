@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/newmizanur/poly-go/polygo"
+)
+
+// TestMain lets the test binary stand in for pgo when go runs it with -exec.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == execCommand {
+		if err := runInOrigin(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestQuoteExecWord(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"/usr/bin/pgo", "/usr/bin/pgo", true},
+		{`/it's/a"b`, `/it's/a"b`, true},
+		{"/my tools/pgo", "'/my tools/pgo'", true},
+		{`/my "tools"/pgo`, `'/my "tools"/pgo'`, true},
+		{"/it's mine/pgo", `"/it's mine/pgo"`, true},
+		{"'pgo", `"'pgo"`, true},
+		{"", "''", true},
+		{`/it's "mine"/pgo`, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := quoteExecWord(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("quoteExecWord(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+	if _, err := execFlag(`/it's "mine"/pgo`); err == nil {
+		t.Error("execFlag accepted a path it cannot quote")
+	}
+}
+
+func TestOriginExecFlag(t *testing.T) {
+	for _, args := range [][]string{
+		{"-exec", "sudo", "."},
+		{"-exec=sudo", "."},
+		{"--exec=sudo", "."},
+	} {
+		if flag, err := originExecFlag(args); flag != "" || err != nil {
+			t.Errorf("originExecFlag(%q) = %q, %v, want no flag", args, flag, err)
+		}
+	}
+	flag, err := originExecFlag([]string{"-v", "."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(flag, "-exec=") || !strings.HasSuffix(flag, " "+execCommand) {
+		t.Errorf("originExecFlag = %q", flag)
+	}
+}
+
+// TestRunInOrigin runs a program with go run through a copy of the test
+// binary in a directory that needs quoting, and checks that it starts in
+// the user's tree rather than the generated workspace.
+func TestRunInOrigin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go run")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found in PATH")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	name := "it's pgo"
+	if runtime.GOOS == "windows" {
+		name = "pgo tools" // quotes are not allowed in Windows file names
+	}
+	binDir := filepath.Join(tmp, name)
+	if err := os.Mkdir(binDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	pgo := filepath.Join(binDir, filepath.Base(self))
+	copyFile(t, self, pgo)
+
+	genDir := filepath.Join(tmp, "app", polygo.GeneratedDirName)
+	originDir := filepath.Join(tmp, "app")
+	for _, dir := range []string{filepath.Join(genDir, "cmd", "tool"), filepath.Join(originDir, "cmd", "tool")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(genDir, "go.mod"), "module example.com/app\n\ngo 1.21\n")
+	writeFile(t, filepath.Join(genDir, "cmd", "tool", "main.go"), `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	wd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(wd)
+}
+`)
+
+	flag, err := execFlag(pgo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "run", flag, ".")
+	cmd.Dir = filepath.Join(genDir, "cmd", "tool")
+	cmd.Env = append(os.Environ(), originEnv(genDir, originDir)...)
+	cmd.Env = append(cmd.Env, "GOFLAGS=")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("go run %s: %v", flag, err)
+	}
+	want, err := filepath.EvalSymlinks(filepath.Join(originDir, "cmd", "tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := filepath.EvalSymlinks(string(out))
+	if err != nil {
+		t.Fatalf("program printed %q: %v", out, err)
+	}
+	if got != want {
+		t.Errorf("program ran in %s, want %s", got, want)
+	}
+}
+
+func copyFile(t *testing.T, from, to string) {
+	t.Helper()
+	in, err := os.Open(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
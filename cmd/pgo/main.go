@@ -5,10 +5,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 
-	"github.com/newmizanur/poly-go/internal/transpile"
-	"github.com/newmizanur/poly-go/internal/workspace"
+	"github.com/newmizanur/poly-go/polygo"
 )
 
 const version = "0.0.1"
@@ -29,6 +29,15 @@ func main() {
 		return
 	}
 	switch cmd {
+	case execCommand:
+		if err := runInOrigin(os.Args[2:]); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				os.Exit(exitErr.ExitCode())
+			}
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	case "version":
 		fmt.Println("pgo", version)
 		return
@@ -39,17 +48,17 @@ func main() {
 		}
 		return
 	case "gen":
-		lang, mapPath, allowGo, _, err := parseFlags(cmd, os.Args[2:])
+		lang, mapPath, allowGo, rest, err := parseFlags(cmd, os.Args[2:])
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
-		if err := runGen(lang, mapPath, allowGo); err != nil {
+		if err := runGen(rest, lang, mapPath, allowGo); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 		return
-	case "build", "run", "test":
+	case "build", "run", "test", "install", "generate", "list", "doc", "mod", "get":
 		lang, mapPath, allowGo, goArgs, err := parseFlags(cmd, os.Args[2:])
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
@@ -63,6 +72,31 @@ func main() {
 			os.Exit(1)
 		}
 		return
+	case "debug":
+		lang, mapPath, allowGo, rest, err := parseFlags(cmd, os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := runDebug(rest, lang, mapPath, allowGo); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				os.Exit(exitErr.ExitCode())
+			}
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	case "cover":
+		if err := runCover(os.Args[2:]); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				os.Exit(exitErr.ExitCode())
+			}
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	case "transpile":
+		os.Exit(runTranspile(os.Args[2:]))
 	case "set":
 		lang, _, _, rest, err := parseFlags(cmd, os.Args[2:])
 		if err != nil {
@@ -88,13 +122,18 @@ func main() {
 }
 
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: pgo <gen|build|run|test|clean|version|set> [--lang=<locale>] [--map=<path>] [--allow-go] [args...]")
+	fmt.Fprintln(os.Stderr, "usage: pgo <gen|build|run|test|install|generate|list|doc|mod|get|debug|cover|transpile|clean|version|set> [--lang=<locale>] [--map=<path>] [--allow-go] [args...]")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "commands:")
-	fmt.Fprintln(os.Stderr, "  gen       generate .pgo_gen")
+	fmt.Fprintln(os.Stderr, "  gen       generate .pgo_gen (--inplace: write _p.go files next to sources, --check: verify them)")
 	fmt.Fprintln(os.Stderr, "  build     build module via .pgo_gen")
 	fmt.Fprintln(os.Stderr, "  run       run module or files via .pgo_gen")
 	fmt.Fprintln(os.Stderr, "  test      test module via .pgo_gen")
+	fmt.Fprintln(os.Stderr, "  install, generate, list, doc, mod, get")
+	fmt.Fprintln(os.Stderr, "            the go commands, run via .pgo_gen; files they write are copied back")
+	fmt.Fprintln(os.Stderr, "  debug     debug with dlv on .p.go sources (--listen=<addr> for editors)")
+	fmt.Fprintln(os.Stderr, "  cover     go tool cover on a pgo test profile (-html shows .p.go sources)")
+	fmt.Fprintln(os.Stderr, "  transpile transpile one file or stdin to stdout (--to-go, --to-local, -o)")
 	fmt.Fprintln(os.Stderr, "  clean     remove .pgo_gen")
 	fmt.Fprintln(os.Stderr, "  set       set default locale in .pgo_lang")
 	fmt.Fprintln(os.Stderr, "  version   print version")
@@ -103,63 +142,270 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "  --lang     locale override (e.g. bn, es, jp, zh)")
 	fmt.Fprintln(os.Stderr, "  --map      custom keyword map path")
 	fmt.Fprintln(os.Stderr, "  --allow-go allow Go keywords in .p.go")
+	fmt.Fprintln(os.Stderr, "  --rewrite-traces (run) report panics against .p.go files and names")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "examples:")
 	fmt.Fprintln(os.Stderr, "  pgo run --lang=bn ./examples/bn.p.go")
+	fmt.Fprintln(os.Stderr, "  pgo test -coverprofile=c.out ./... && pgo cover -html=c.out")
+	fmt.Fprintln(os.Stderr, "  cat main.p.go | pgo transpile --lang=es --to-go -")
+	fmt.Fprintln(os.Stderr, "  GOOS=windows GOARCH=amd64 pgo build -o app.exe .")
 	fmt.Fprintln(os.Stderr, "  pgo set jp")
 }
 
 func runClean() error {
-	moduleRoot, err := workspace.FindModuleRoot(mustGetwd())
+	moduleRoot, err := polygo.FindRoot(mustGetwd())
 	if err != nil {
 		return err
 	}
-	return os.RemoveAll(filepath.Join(moduleRoot, workspace.GeneratedDirName))
+	return polygo.Clean(moduleRoot)
 }
 
-func runGen(lang string, mapPath string, allowGo bool) error {
-	moduleRoot, err := workspace.FindModuleRoot(mustGetwd())
+func runGen(args []string, lang string, mapPath string, allowGo bool) error {
+	args, inPlace := cutFlag(args, "--inplace")
+	args, check := cutFlag(args, "--check")
+	if len(args) > 0 {
+		return fmt.Errorf("pgo gen: unexpected arguments: %s", strings.Join(args, " "))
+	}
+	if check && !inPlace {
+		return fmt.Errorf("pgo gen: --check requires --inplace")
+	}
+	moduleRoot, err := polygo.FindRoot(mustGetwd())
+	if err != nil {
+		return err
+	}
+	maps, resolvedLang, err := polygo.ModuleMaps(moduleRoot, lang, mapPath, allowGo)
 	if err != nil {
 		return err
 	}
-	maps, resolvedLang, err := loadMaps(moduleRoot, lang, mapPath, allowGo)
+	if !inPlace {
+		return polygo.Generate(moduleRoot, maps, generateOptions(resolvedLang))
+	}
+
+	opts := generateOptions(resolvedLang)
+	if !check {
+		changes, err := polygo.GenerateInPlace(moduleRoot, maps, opts)
+		for _, c := range changes {
+			fmt.Fprintf(os.Stderr, "pgo: %s: %s\n", c.Path, c.Reason)
+		}
+		return err
+	}
+	changes, err := polygo.CheckInPlace(moduleRoot, maps, opts)
 	if err != nil {
 		return err
 	}
-	return workspace.Generate(moduleRoot, maps, resolvedLang)
+	if len(changes) == 0 {
+		return nil
+	}
+	for _, c := range changes {
+		fmt.Fprintf(os.Stderr, "pgo: %s: %s\n", c.Path, c.Reason)
+	}
+	return fmt.Errorf("pgo: generated Go files are out of date; run pgo gen --inplace")
+}
+
+// generateOptions returns the options every command generates with.
+func generateOptions(locale string) polygo.GenerateOptions {
+	return polygo.GenerateOptions{
+		Locale:  locale,
+		ModFlag: modFlagValue(nil),
+		Warn: func(err error) {
+			fmt.Fprintf(os.Stderr, "pgo: warning: %v\n", err)
+		},
+	}
 }
 
 func runGo(subcmd string, args []string, lang string, mapPath string, allowGo bool) error {
-	moduleRoot, err := workspace.FindModuleRoot(mustGetwd())
+	moduleRoot, err := polygo.FindRoot(mustGetwd())
 	if err != nil {
 		return err
 	}
-	maps, resolvedLang, err := loadMaps(moduleRoot, lang, mapPath, allowGo)
+	maps, resolvedLang, err := polygo.ModuleMaps(moduleRoot, lang, mapPath, allowGo)
 	if err != nil {
 		return err
 	}
-	if err := workspace.Generate(moduleRoot, maps, resolvedLang); err != nil {
+	opts := generateOptions(resolvedLang)
+	opts.ModFlag = modFlagValue(args)
+	if subcmd == "mod" || subcmd == "get" {
+		// They work on the module graph; vendor/ is their output at most.
+		opts.ModFlag = "mod"
+	}
+	if err := polygo.Generate(moduleRoot, maps, opts); err != nil {
 		return err
 	}
 
-	goArgs := mapArgsForGenerated(args)
+	genDir := filepath.Join(moduleRoot, polygo.GeneratedDirName)
+	args, rewriteTraces := cutFlag(args, "--rewrite-traces")
+	goArgs := mapArgsForGenerated(subcmd, args, maps, moduleRoot)
+	env := os.Environ()
+	if (subcmd == "run" || subcmd == "test") && !crossCompiling() {
+		execFlag, err := originExecFlag(goArgs)
+		if err != nil {
+			return err
+		}
+		if execFlag != "" {
+			goArgs = append([]string{execFlag}, goArgs...)
+			env = append(env, originEnv(genDir, moduleRoot)...)
+		}
+	}
 	cmd := exec.Command("go", append([]string{subcmd}, goArgs...)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
-	cmd.Dir = filepath.Join(moduleRoot, workspace.GeneratedDirName)
-	cmd.Env = os.Environ()
-	return cmd.Run()
+	cmd.Dir, err = generatedWorkDir(moduleRoot)
+	if err != nil {
+		return err
+	}
+	cmd.Env = env
+	if subcmd == "run" && (rewriteTraces || os.Getenv("PGO_REWRITE_TRACES") == "1") {
+		// Report panics and compiler errors against the .p.go sources.
+		names, err := polygo.LoadNames(moduleRoot)
+		if err != nil {
+			return err
+		}
+		stderr := newLineRewriter(os.Stderr, names.TraceReplacer(genDir, moduleRoot))
+		cmd.Stderr = stderr
+		runErr := cmd.Run()
+		stderr.Flush()
+		return runErr
+	}
+	switch subcmd {
+	case "list", "doc":
+		// Report generated paths and names in the user's spelling.
+		names, err := polygo.LoadNames(moduleRoot)
+		if err != nil {
+			return err
+		}
+		if subcmd == "doc" {
+			cmd.Args = append([]string{"go", subcmd}, mapDocArgs(goArgs, names)...)
+		}
+		replacer := names.TraceReplacer(genDir, moduleRoot)
+		stdout := newLineRewriter(os.Stdout, replacer)
+		stderr := newLineRewriter(os.Stderr, replacer)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		runErr := cmd.Run()
+		stdout.Flush()
+		stderr.Flush()
+		return runErr
+	case "generate", "mod", "get":
+		// Keep what these commands write (generated files, go.mod, go.sum);
+		// .pgo_gen is recreated on every run.
+		before, err := polygo.TakeSnapshot(moduleRoot)
+		if err != nil {
+			return err
+		}
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+		copied, err := polygo.SyncBack(moduleRoot, before)
+		for _, rel := range copied {
+			fmt.Fprintln(os.Stderr, "pgo: updated", rel)
+		}
+		return err
+	case "build":
+		if hasFlag(goArgs, "-o") {
+			return cmd.Run()
+		}
+		// Without -o, go build leaves the binary in its working directory;
+		// move it to the user's.
+		return moveOutput(cmd, cmd.Dir, buildOutputName(goArgs, cmd.Dir), mustGetwd())
+	case "test":
+		// Handled below.
+	default:
+		return cmd.Run()
+	}
+
+	// Accept and report test names and files in their localized spelling.
+	names, err := polygo.LoadNames(moduleRoot)
+	if err != nil {
+		return err
+	}
+	_, coverProfile := coverProfileArg(goArgs)
+	cmd.Args = append([]string{"go", subcmd}, mapTestPatterns(goArgs, names)...)
+	replacer := names.Replacer()
+	stdout := newLineRewriter(os.Stdout, replacer)
+	stderr := newLineRewriter(os.Stderr, replacer)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	runErr := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+	if coverProfile != "" {
+		if err := rewriteCoverProfile(moduleRoot, coverProfile); err != nil {
+			return err
+		}
+	}
+	return runErr
+}
+
+// crossCompiling reports whether GOOS or GOARCH select another platform.
+// Binaries are then left to go's own go_$GOOS_$GOARCH_exec lookup.
+func crossCompiling() bool {
+	goos, goarch := os.Getenv("GOOS"), os.Getenv("GOARCH")
+	return goos != "" && goos != runtime.GOOS || goarch != "" && goarch != runtime.GOARCH
+}
+
+// mapDocArgs lets go doc take localized names of mangled identifiers, alone
+// or as parts of pkg.Name.Method.
+func mapDocArgs(args []string, names polygo.Names) []string {
+	generated := make(map[string]string, len(names.Idents))
+	for gen, orig := range names.Idents {
+		generated[orig] = gen
+	}
+	out := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			out = append(out, arg)
+			continue
+		}
+		parts := strings.Split(arg, ".")
+		for i, part := range parts {
+			if gen, ok := generated[part]; ok {
+				parts[i] = gen
+			}
+		}
+		out = append(out, strings.Join(parts, "."))
+	}
+	return out
 }
 
-func mapArgsForGenerated(args []string) []string {
+// cutFlag removes a pgo-only boolean flag from go arguments.
+func cutFlag(args []string, flag string) ([]string, bool) {
 	out := make([]string, 0, len(args))
+	found := false
 	for _, arg := range args {
-		if strings.HasSuffix(arg, ".p.go") {
-			out = append(out, strings.TrimSuffix(arg, ".p.go")+"_p.go")
+		if arg == flag {
+			found = true
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out, found
+}
+
+var testPatternFlags = map[string]bool{
+	"-run": true, "-bench": true, "-skip": true, "-fuzz": true,
+	"-test.run": true, "-test.bench": true, "-test.skip": true, "-test.fuzz": true,
+}
+
+func mapTestPatterns(args []string, names polygo.Names) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		flagName := "-" + strings.TrimLeft(name, "-")
+		if !testPatternFlags[flagName] {
+			out = append(out, arg)
+			continue
+		}
+		if hasValue {
+			out = append(out, name+"="+names.TestPattern(value))
 			continue
 		}
 		out = append(out, arg)
+		if i+1 < len(args) {
+			out = append(out, names.TestPattern(args[i+1]))
+			i++
+		}
 	}
 	return out
 }
@@ -213,96 +459,14 @@ func parseFlags(_ string, args []string) (string, string, bool, []string, error)
 	return lang, mapPath, allowGo, rest, nil
 }
 
-func loadMaps(moduleRoot string, langFlag string, mapPath string, allowGo bool) (transpile.Maps, string, error) {
-	resolvedLang, err := resolveLang(moduleRoot, langFlag)
-	if err != nil {
-		return transpile.Maps{}, "", err
-	}
-	if mapPath != "" {
-		data, err := os.ReadFile(mapPath)
-		if err != nil {
-			return transpile.Maps{}, "", err
-		}
-		maps, err := transpile.LoadKeywordMapData(data, allowGo)
-		return maps, resolvedLang, err
-	}
-	data, err := keywordMapData(moduleRoot, resolvedLang)
-	if err != nil {
-		return transpile.Maps{}, "", err
-	}
-	maps, err := transpile.LoadKeywordMapData(data, allowGo)
-	return maps, resolvedLang, err
-}
-
-func resolveLang(moduleRoot, langFlag string) (string, error) {
-	if langFlag != "" {
-		return langFlag, nil
-	}
-	if env := strings.TrimSpace(os.Getenv("PGO_LANG")); env != "" {
-		return env, nil
-	}
-	if env := strings.TrimSpace(os.Getenv("POLYGO_LANG")); env != "" {
-		return env, nil
-	}
-	if env := strings.TrimSpace(os.Getenv("BGO_LANG")); env != "" {
-		return env, nil
-	}
-	path := filepath.Join(moduleRoot, ".pgo_lang")
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "", nil
-		}
-		return "", err
-	}
-	if lang := strings.TrimSpace(string(data)); lang != "" {
-		return lang, nil
-	}
-	return "", nil
-}
-
-func keywordMapData(moduleRoot, lang string) ([]byte, error) {
-	if lang != "" {
-		if data, err := os.ReadFile(filepath.Join(moduleRoot, "lang", lang+".json")); err == nil {
-			return data, nil
-		} else if !os.IsNotExist(err) {
-			return nil, err
-		}
-		if data, ok := transpile.EmbeddedKeywordMap(lang); ok {
-			return data, nil
-		}
-		return nil, fmt.Errorf("keyword map for lang %q not found (moduleRoot/lang or embedded)", lang)
-	}
-	if data, err := os.ReadFile(filepath.Join(moduleRoot, "keywords.json")); err == nil {
-		return data, nil
-	} else if !os.IsNotExist(err) {
-		return nil, err
-	}
-	if data, ok := transpile.EmbeddedKeywordMap(transpile.DefaultLocale); ok {
-		return data, nil
-	}
-	return nil, fmt.Errorf("no embedded keyword maps found")
-}
-
 func setDefaultLang(lang string) error {
-	moduleRoot, err := workspace.FindModuleRoot(mustGetwd())
+	moduleRoot, err := polygo.FindRoot(mustGetwd())
 	if err != nil {
 		return err
 	}
-	if !localeAvailable(moduleRoot, lang) {
+	if !polygo.LocaleAvailable(moduleRoot, lang) {
 		return fmt.Errorf("unknown locale %q (no moduleRoot/lang or embedded map)", lang)
 	}
 	path := filepath.Join(moduleRoot, ".pgo_lang")
 	return os.WriteFile(path, []byte(strings.TrimSpace(lang)+"\n"), 0o644)
 }
-
-func localeAvailable(moduleRoot, lang string) bool {
-	if lang == "" {
-		return false
-	}
-	if _, err := os.Stat(filepath.Join(moduleRoot, "lang", lang+".json")); err == nil {
-		return true
-	}
-	_, ok := transpile.EmbeddedKeywordMap(lang)
-	return ok
-}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/newmizanur/poly-go/polygo"
+)
+
+// lineRewriter applies a replacer to each complete line written to it, so
+// names are never split across writes.
+type lineRewriter struct {
+	w   io.Writer
+	r   *polygo.Replacer
+	buf []byte
+}
+
+func newLineRewriter(w io.Writer, r *polygo.Replacer) *lineRewriter {
+	return &lineRewriter{w: w, r: r}
+}
+
+func (lw *lineRewriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	end := bytes.LastIndexByte(lw.buf, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+	if _, err := lw.r.WriteString(lw.w, string(lw.buf[:end+1])); err != nil {
+		return 0, err
+	}
+	lw.buf = append(lw.buf[:0], lw.buf[end+1:]...)
+	return len(p), nil
+}
+
+// Flush writes any trailing partial line.
+func (lw *lineRewriter) Flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	_, err := lw.r.WriteString(lw.w, string(lw.buf))
+	lw.buf = lw.buf[:0]
+	return err
+}
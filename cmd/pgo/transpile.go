@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/newmizanur/poly-go/polygo"
+)
+
+// Exit codes of pgo transpile.
+const (
+	exitTranspileError = 1 // the source could not be transpiled
+	exitUsageError     = 2 // bad flags or arguments
+	exitIOError        = 3 // reading input, writing output or loading the map failed
+)
+
+type transpileError struct{ err error }
+
+func (e transpileError) Error() string { return e.err.Error() }
+
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+const transpileUsage = "usage: pgo transpile [--lang=<locale>] [--map=<path>] [--allow-go] [--to-go|--to-local] [--localize-digits] [--stdin-path=<name>] [-o <file>] [file|-]"
+
+// runTranspile transpiles a single file, or stdin, without touching
+// .pgo_gen. The direction comes from --to-go/--to-local, else from the file
+// suffix (.p.go → Go, .go → localized), else it is detected from the source.
+func runTranspile(args []string) int {
+	err := transpileCommand(args, os.Stdin, os.Stdout)
+	if err == nil {
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, "pgo transpile:", err)
+	code := transpileExitCode(err)
+	if code == exitUsageError {
+		fmt.Fprintln(os.Stderr, transpileUsage)
+	}
+	return code
+}
+
+// transpileExitCode classifies an error of transpileCommand.
+func transpileExitCode(err error) int {
+	var usageErr usageError
+	var transpileErr transpileError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &usageErr):
+		return exitUsageError
+	case errors.As(err, &transpileErr):
+		return exitTranspileError
+	default:
+		return exitIOError
+	}
+}
+
+func transpileCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	lang, mapPath, allowGo, rest, err := parseFlags("transpile", args)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	var toGo, toLocal, localizeDigits bool
+	var outPath, stdinPath string
+	var inputs []string
+	for i := 0; i < len(rest); i++ {
+		arg := rest[i]
+		switch {
+		case arg == "--to-go":
+			toGo = true
+		case arg == "--to-local":
+			toLocal = true
+		case arg == "--localize-digits":
+			localizeDigits = true
+		case arg == "-o" || arg == "--output":
+			if i+1 >= len(rest) {
+				return usageError{"missing value for " + arg}
+			}
+			outPath = rest[i+1]
+			i++
+		case strings.HasPrefix(arg, "-o="), strings.HasPrefix(arg, "--output="):
+			_, outPath, _ = strings.Cut(arg, "=")
+		case strings.HasPrefix(arg, "--stdin-path="):
+			stdinPath = strings.TrimPrefix(arg, "--stdin-path=")
+		case arg == "-" || !strings.HasPrefix(arg, "-"):
+			inputs = append(inputs, arg)
+		default:
+			return usageError{"unknown flag " + arg}
+		}
+	}
+	if toGo && toLocal {
+		return usageError{"--to-go and --to-local are mutually exclusive"}
+	}
+	if len(inputs) > 1 {
+		return usageError{"only one input file can be transpiled at a time"}
+	}
+
+	input := "-"
+	if len(inputs) == 1 {
+		input = inputs[0]
+	}
+	path := input
+	var src []byte
+	if input == "-" {
+		path = stdinPath
+		src, err = io.ReadAll(stdin)
+	} else {
+		src, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Outside a module the locale still comes from flags and environment.
+	moduleRoot, err := polygo.FindRoot(mustGetwd())
+	if err != nil {
+		moduleRoot = mustGetwd()
+	}
+	maps, _, err := polygo.ModuleMaps(moduleRoot, lang, mapPath, allowGo)
+	if err != nil {
+		return err
+	}
+	if localizeDigits {
+		if maps.Digits == "" {
+			return usageError{"--localize-digits: the keyword map has no digits"}
+		}
+		maps.LocalizeDigits = true
+	}
+	// Transliterated names map back to the identifiers they were given to.
+	maps, err = polygo.WithTransliteration(moduleRoot, maps, polygo.GenerateOptions{})
+	if err != nil {
+		return err
+	}
+
+	if !toGo && !toLocal {
+		toGo = strings.HasSuffix(path, ".p.go")
+		toLocal = !toGo && strings.HasSuffix(path, ".go")
+	}
+	var out []byte
+	switch {
+	case toGo:
+		if path == "" {
+			path = "stdin.p.go"
+		}
+		out, err = polygo.ToGo(path, src, maps)
+	case toLocal:
+		if path == "" {
+			path = "stdin.go"
+		}
+		out, err = polygo.ToLocal(path, src, maps)
+	default:
+		if path == "" {
+			path = "stdin"
+		}
+		out, err = polygo.Transpile(path, src, maps)
+		if err != nil {
+			err = fmt.Errorf("%w with --to-go or --to-local", err)
+		}
+	}
+	if err != nil {
+		return transpileError{err}
+	}
+
+	if outPath == "" || outPath == "-" {
+		_, err = stdout.Write(out)
+		return err
+	}
+	return os.WriteFile(outPath, out, 0o644)
+}
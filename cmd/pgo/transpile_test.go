@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranspileCommand(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	local := write("main.p.go", "paquete main\n\nfuncion main() {}\n")
+	goSrc := write("main.go", "package main\n\nfunc main() {}\n")
+	mixed := "package main\n\nfunc main() { si true {} }\n"
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		code    int
+		want    string // in stdout
+		wantErr string
+	}{
+		{name: "file to go", args: []string{"--lang=es", local}, want: "func main() {}"},
+		{name: "file to local", args: []string{"--lang=es", goSrc}, want: "funcion main() {}"},
+		{name: "forced direction", args: []string{"--lang=es", "--to-local", local}, want: "paquete main"},
+		{name: "stdin path", args: []string{"--lang=es", "--stdin-path=x_test.p.go", "-"}, stdin: "paquete p\n\nfuncion PruebaX() {}\n", want: "func TestX() {}"},
+		{name: "stdin go path", args: []string{"--lang=es", "--stdin-path=x.go"}, stdin: "package p\n", want: "paquete p"},
+		{name: "stdin detected", args: []string{"--lang", "es"}, stdin: "paquete p\n", want: "package p"},
+		{name: "stdout dash", args: []string{"--lang=es", "-o", "-", local}, want: "package main"},
+
+		{name: "conflict", args: []string{"--to-go", "--to-local", local}, code: exitUsageError, wantErr: "mutually exclusive"},
+		{name: "conflict stdin", args: []string{"--to-local", "--stdin-path=x.go", "--to-go"}, code: exitUsageError, wantErr: "mutually exclusive"},
+		{name: "two inputs", args: []string{local, goSrc}, code: exitUsageError, wantErr: "one input"},
+		{name: "unknown flag", args: []string{"--reverse", local}, code: exitUsageError, wantErr: "unknown flag --reverse"},
+		{name: "missing output", args: []string{local, "-o"}, code: exitUsageError, wantErr: "missing value for -o"},
+		{name: "missing lang", args: []string{"--lang"}, code: exitUsageError, wantErr: "missing value for --lang"},
+		{name: "no digits", args: []string{"--lang=es", "--localize-digits", goSrc}, code: exitUsageError, wantErr: "no digits"},
+
+		{name: "go keyword", args: []string{"--lang=es", "--to-go"}, stdin: mixed, code: exitTranspileError, wantErr: `go keyword "package"`},
+		{name: "auto-detect", args: []string{"--lang=es"}, stdin: mixed, code: exitTranspileError, wantErr: "with --to-go or --to-local"},
+		{name: "auto-detect stdin path", args: []string{"--lang=es", "--stdin-path=x"}, stdin: mixed, code: exitTranspileError, wantErr: "x: cannot tell"},
+
+		{name: "missing input", args: []string{"--lang=es", filepath.Join(dir, "none.p.go")}, code: exitIOError, wantErr: "none.p.go"},
+		{name: "missing map", args: []string{"--map=" + filepath.Join(dir, "none.json"), local}, code: exitIOError, wantErr: "none.json"},
+		{name: "unwritable output", args: []string{"--lang=es", "-o", filepath.Join(dir, "none", "out.go"), local}, code: exitIOError, wantErr: "out.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := transpileCommand(tt.args, strings.NewReader(tt.stdin), &stdout)
+			if code := transpileExitCode(err); code != tt.code {
+				t.Fatalf("exit code %d, want %d (error %v)", code, tt.code, err)
+			}
+			if tt.code != 0 {
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error %q does not contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if !strings.Contains(stdout.String(), tt.want) {
+				t.Errorf("output does not contain %q:\n%s", tt.want, stdout.String())
+			}
+		})
+	}
+}
+
+func TestTranspileCommandOutput(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "main.p.go")
+	if err := os.WriteFile(input, []byte("paquete main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for i, flag := range []string{"-o", "-o=", "--output", "--output="} {
+		out := filepath.Join(dir, fmt.Sprintf("out%d.go", i))
+		args := []string{"--lang=es", input, flag + out}
+		if !strings.HasSuffix(flag, "=") {
+			args = []string{"--lang=es", flag, out, input}
+		}
+		var stdout bytes.Buffer
+		if err := transpileCommand(args, strings.NewReader(""), &stdout); err != nil {
+			t.Fatalf("%q: %v", flag, err)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("%q wrote to stdout: %q", flag, stdout.String())
+		}
+		got, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("%q: %v", flag, err)
+		}
+		if string(got) != "package main\n" {
+			t.Errorf("%q wrote %q", flag, got)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package transpile
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	goBuildPrefix  = "//go:build"
+	pgoBuildPrefix = "//pgo:build"
+)
+
+// Mirrors go/build's known GOOS/GOARCH lists, which decide whether a file
+// name suffix is a constraint.
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true,
+	"freebsd": true, "hurd": true, "illumos": true, "ios": true,
+	"js": true, "linux": true, "nacl": true, "netbsd": true,
+	"openbsd": true, "plan9": true, "solaris": true, "wasip1": true,
+	"windows": true, "zos": true,
+}
+
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true,
+	"armbe": true, "arm64": true, "arm64be": true, "loong64": true,
+	"mips": true, "mipsle": true, "mips64": true, "mips64le": true,
+	"mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true,
+	"ppc64le": true, "riscv": true, "riscv64": true, "s390": true,
+	"s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+}
+
+// GoFileName returns the generated Go file name for a .p.go path.
+// The "_p" marker is inserted before any _GOOS, _GOARCH and _test suffixes
+// (localized suffixes are translated through the build tag map) so the go
+// tool applies the same file name constraints as it would to the source.
+func GoFileName(name string, maps Maps) string {
+	if !strings.HasSuffix(name, ".p.go") {
+		return name
+	}
+	dirLen := strings.LastIndexAny(name, `/\`) + 1
+	dir, stem := name[:dirLen], strings.TrimSuffix(name[dirLen:], ".p.go")
+
+	elems := strings.Split(stem, "_")
+	suffix := func(i int) string {
+		if tag, ok := maps.LocalBuildTags[elems[i]]; ok {
+			return tag
+		}
+		return elems[i]
+	}
+
+	// Like go/build, everything before the first "_" is never a constraint.
+	cut := len(elems)
+	if cut > 1 && suffix(cut-1) == "test" {
+		elems[cut-1] = "test"
+		cut--
+	}
+	if cut > 2 && knownOS[suffix(cut-2)] && knownArch[suffix(cut-1)] {
+		elems[cut-2], elems[cut-1] = suffix(cut-2), suffix(cut-1)
+		cut -= 2
+	} else if cut > 1 && (knownOS[suffix(cut-1)] || knownArch[suffix(cut-1)]) {
+		elems[cut-1] = suffix(cut - 1)
+		cut--
+	}
+
+	out := make([]string, 0, len(elems)+1)
+	out = append(out, elems[:cut]...)
+	out = append(out, "p")
+	out = append(out, elems[cut:]...)
+	return dir + strings.Join(out, "_") + ".go"
+}
+
+func isBuildLine(trimmed string) bool {
+	return strings.HasPrefix(trimmed, goBuildPrefix) ||
+		strings.HasPrefix(trimmed, "// +build") ||
+		strings.HasPrefix(trimmed, pgoBuildPrefix)
+}
+
+// translateBuildPrefix rewrites localized //pgo:build lines in the leading
+// constraint block into //go:build lines.
+func translateBuildPrefix(prefix []byte, maps Maps) ([]byte, error) {
+	if !strings.Contains(string(prefix), pgoBuildPrefix) {
+		return prefix, nil
+	}
+	lines := strings.SplitAfter(string(prefix), "\n")
+	seenGo := false
+	seenPgo := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, goBuildPrefix) {
+			seenGo = true
+			continue
+		}
+		if !strings.HasPrefix(trimmed, pgoBuildPrefix) {
+			continue
+		}
+		if seenPgo {
+			return nil, fmt.Errorf("line %d: multiple //pgo:build lines", i+1)
+		}
+		seenPgo = true
+		expr, err := translateBuildExpr(strings.TrimPrefix(trimmed, pgoBuildPrefix), maps)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		eol := line[len(strings.TrimRight(line, "\r\n")):]
+		lines[i] = goBuildPrefix + " " + expr + eol
+	}
+	if seenGo && seenPgo {
+		return nil, fmt.Errorf("both //go:build and //pgo:build present; use only one")
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+func translateBuildExpr(expr string, maps Maps) (string, error) {
+	var b strings.Builder
+	idx := 0
+	for idx < len(expr) {
+		r, size := utf8.DecodeRuneInString(expr[idx:])
+		if !isBuildTagRune(r) {
+			b.WriteRune(r)
+			idx += size
+			continue
+		}
+		end := idx
+		for end < len(expr) {
+			r, size := utf8.DecodeRuneInString(expr[end:])
+			if !isBuildTagRune(r) {
+				break
+			}
+			end += size
+		}
+		tag := expr[idx:end]
+		if mapped, ok := maps.LocalBuildTags[tag]; ok {
+			tag = mapped
+		} else if !isGoBuildTag(tag) {
+			return "", fmt.Errorf("unknown build tag %q", tag)
+		}
+		b.WriteString(tag)
+		idx = end
+	}
+	out := strings.TrimSpace(b.String())
+	if _, err := constraint.Parse(goBuildPrefix + " " + out); err != nil {
+		return "", fmt.Errorf("invalid build expression %q: %w", strings.TrimSpace(expr), err)
+	}
+	return out, nil
+}
+
+func isBuildTagRune(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mark, r)
+}
+
+func isGoBuildTag(tag string) bool {
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if c != '_' && c != '.' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return tag != ""
+}
@@ -0,0 +1,59 @@
+package transpile
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoFileName(t *testing.T) {
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"main.p.go":                "main_p.go",
+		"linux.p.go":               "linux_p.go",
+		"main_linux.p.go":          "main_p_linux.go",
+		"main_linux_amd64.p.go":    "main_p_linux_amd64.go",
+		"main_amd64.p.go":          "main_p_amd64.go",
+		"foo_test.p.go":            "foo_p_test.go",
+		"foo_windows_test.p.go":    "foo_p_windows_test.go",
+		"foo_bar.p.go":             "foo_bar_p.go",
+		"pkg/sub/foo_লিনাক্স.p.go": "pkg/sub/foo_p_linux.go",
+		"foo_লিনাক্স_পরীক্ষা.p.go": "foo_p_linux_test.go",
+		"foo_অন্য.p.go":            "foo_অন্য_p.go",
+		"main.go":                  "main.go",
+	}
+	for in, want := range cases {
+		if got := GoFileName(in, maps); got != want {
+			t.Errorf("GoFileName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLocalizedBuildConstraint(t *testing.T) {
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := "//pgo:build লিনাক্স && !(উইন্ডোজ || cgo)\n\nপ্যাকেজ main\n"
+	got, err := TranspileFileLocalizedToGo("main.p.go", []byte(src), maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "//go:build linux && !(windows || cgo)\n\npackage main\n"
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{
+		"//pgo:build অজানা\n\nপ্যাকেজ main\n",
+		"//pgo:build লিনাক্স &&\n\nপ্যাকেজ main\n",
+		"//go:build linux\n//pgo:build লিনাক্স\n\nপ্যাকেজ main\n",
+	} {
+		if _, err := TranspileFileLocalizedToGo("main.p.go", []byte(bad), maps); err == nil {
+			t.Errorf("expected error for %q", strings.SplitN(bad, "\n", 2)[0])
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package transpile
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ambiguousConfidence is the confidence below which DetectDirection refuses
+// to pick a direction for input with evidence for both.
+const ambiguousConfidence = 0.8
+
+// Detection is the result of DetectDirection.
+type Detection struct {
+	Direction Direction
+	// Confidence is the share of the evidence that supports Direction, from
+	// 0.5 to 1; it is 0 when the source has no evidence at all.
+	Confidence float64
+	// Local and Go are the scores of the two languages, and FirstLocal and
+	// FirstGo their first evidence (zero if there is none).
+	Local, Go           int
+	FirstLocal, FirstGo Evidence
+}
+
+// Evidence is a word DetectDirection counted, at a 1-based line and byte
+// column.
+type Evidence struct {
+	Line, Column int
+	Word         string
+}
+
+// Keywords weigh more than predeclared names, which are ordinary
+// identifiers in both languages and often used as names.
+const (
+	keywordScore     = 2
+	predeclaredScore = 1
+)
+
+// DetectDirection guesses whether src is localized or Go source by scoring
+// the words of either language, except identity entries. Words after a dot
+// and field names in struct and interface bodies are names, not evidence:
+// a .p.go file may well have a field called type. Source with evidence for
+// both languages and a confidence below 0.8 is an error, so mixed input is
+// not silently transpiled the wrong way; pass an explicit direction then.
+func DetectDirection(src []byte, maps Maps) (Detection, error) {
+	var d Detection
+	// The positions of the first evidence are computed at the end.
+	var firstLocal, firstGo *keywordToken
+	evidence := func(t *keywordToken, score int, local bool) {
+		if local {
+			if firstLocal == nil {
+				firstLocal = t
+			}
+			d.Local += score
+			return
+		}
+		if firstGo == nil {
+			firstGo = t
+		}
+		d.Go += score
+	}
+	at := func(t *keywordToken) Evidence {
+		if t == nil {
+			return Evidence{}
+		}
+		line := 1 + bytes.Count(src[:t.off], []byte("\n"))
+		return Evidence{Line: line, Column: t.off - bytes.LastIndexByte(src[:t.off], '\n'), Word: t.text}
+	}
+	isBodyKeyword := func(word string) bool {
+		if word == "struct" || word == "interface" {
+			return true
+		}
+		keyword := maps.LocalToGo[word]
+		return keyword == "struct" || keyword == "interface"
+	}
+
+	toks := scanKeywordTokens(src)
+	// stack holds the open braces; true for struct and interface bodies.
+	var stack []bool
+	for i, t := range toks {
+		var prev keywordToken
+		if i > 0 {
+			prev = toks[i-1]
+		}
+		switch t.kind {
+		case kwPunct:
+			switch t.text {
+			case "{":
+				stack = append(stack, isBodyKeyword(prev.text))
+			case "}":
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+			continue
+		case kwIdent:
+		default:
+			continue
+		}
+		if _, ok := maps.Identity[t.text]; ok {
+			continue
+		}
+		if prev.kind == kwPunct && (prev.text == "." || prev.text == "@") {
+			continue
+		}
+		inBody := len(stack) > 0 && stack[len(stack)-1]
+		if inBody && (i == 0 || prev.kind == kwNewline || prev.text == "{" || prev.text == ";" || prev.text == ",") {
+			continue
+		}
+		if _, ok := maps.LocalToGo[t.text]; ok {
+			evidence(&toks[i], keywordScore, true)
+		} else if _, ok := maps.LocalPredeclared[t.text]; ok {
+			evidence(&toks[i], predeclaredScore, true)
+		} else if _, ok := maps.GoToLocal[t.text]; ok {
+			evidence(&toks[i], keywordScore, false)
+		} else if _, ok := maps.GoPredeclared[t.text]; ok {
+			evidence(&toks[i], predeclaredScore, false)
+		}
+	}
+
+	d.FirstLocal, d.FirstGo = at(firstLocal), at(firstGo)
+	total := d.Local + d.Go
+	if total == 0 {
+		d.Direction = LocalToGo
+		return d, nil
+	}
+	d.Direction = LocalToGo
+	d.Confidence = float64(d.Local) / float64(total)
+	if d.Go > d.Local {
+		d.Direction = GoToLocal
+		d.Confidence = float64(d.Go) / float64(total)
+	}
+	if d.Local > 0 && d.Go > 0 && d.Confidence < ambiguousConfidence {
+		return d, fmt.Errorf("cannot tell whether the source is localized or Go: %q at %d:%d is localized, %q at %d:%d is Go (confidence %.0f%%); choose a direction",
+			d.FirstLocal.Word, d.FirstLocal.Line, d.FirstLocal.Column,
+			d.FirstGo.Word, d.FirstGo.Line, d.FirstGo.Column, 100*d.Confidence)
+	}
+	return d, nil
+}
@@ -0,0 +1,67 @@
+package transpile
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectDirection(t *testing.T) {
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "es.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		src  string
+		want Direction
+	}{
+		{"localized", "paquete x\n\nfuncion f() entero {\n\tretornar 1\n}\n", LocalToGo},
+		{"go", "package x\n\nfunc f() int {\n\treturn 1\n}\n", GoToLocal},
+		// Go keywords as field names and selectors are names, not evidence.
+		{"field named type", "paquete x\n\ntipo T estructura {\n\ttype cadena\n\tfunc, range entero\n}\n\nfuncion f(t T) cadena {\n\tretornar t.type\n}\n", LocalToGo},
+		{"localized names in go", "package x\n\ntype T struct {\n\tsi, tipo int\n}\n\nfunc f(t T) int {\n\treturn t.tipo\n}\n", GoToLocal},
+		// A Go word or two in a long localized file does not flip it.
+		{"mostly localized", "paquete x\n\nfuncion f() entero {\n\tsi verdadero {\n\t\tretornar longitud(\"ab\")\n\t}\n\tretornar len(\"a\")\n}\n", LocalToGo},
+		{"empty", "", LocalToGo},
+	}
+	for _, tt := range tests {
+		d, err := DetectDirection([]byte(tt.src), maps)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if d.Direction != tt.want {
+			t.Errorf("%s: DetectDirection = %+v, want direction %d", tt.name, d, tt.want)
+		}
+	}
+
+	mixed := "paquete x\n\nfunc f() int {\n\tretornar 1\n}\n"
+	d, err := DetectDirection([]byte(mixed), maps)
+	if err == nil {
+		t.Fatalf("DetectDirection(%q) = %+v, want an ambiguity error", mixed, d)
+	}
+	if d.FirstLocal != (Evidence{Line: 1, Column: 1, Word: "paquete"}) || d.FirstGo != (Evidence{Line: 3, Column: 1, Word: "func"}) {
+		t.Errorf("evidence = %+v, %+v", d.FirstLocal, d.FirstGo)
+	}
+	if _, err := TranspileFile("x.p.go", []byte(mixed), maps, AutoDirection); err == nil || !strings.Contains(err.Error(), "x.p.go") {
+		t.Errorf("TranspileFile(AutoDirection) error = %v", err)
+	}
+	// An explicit direction transpiles like TranspileFileLocalizedToGo, Go
+	// keywords included.
+	if _, err := TranspileFile("x.p.go", []byte(mixed), maps, LocalToGo); err == nil || !strings.Contains(err.Error(), `"funcion"`) {
+		t.Errorf("TranspileFile(LocalToGo) error = %v, want one naming funcion", err)
+	}
+	maps.AllowGoKeywords = true
+	got, err := TranspileFile("x.p.go", []byte(mixed), maps, LocalToGo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package x\n\nfunc f() int {\n\treturn 1\n}\n"; string(got) != want {
+		t.Errorf("TranspileFile(LocalToGo) = %q, want %q", got, want)
+	}
+	if err := TranspileStream(io.Discard, strings.NewReader(mixed), "x.p.go", maps, AutoDirection); err == nil {
+		t.Errorf("TranspileStream accepted AutoDirection")
+	}
+}
@@ -0,0 +1,330 @@
+package transpile
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const pgoDirectivePrefix = "//pgo:"
+
+// EmbedDirective is a //go:embed line of a Go source file.
+type EmbedDirective struct {
+	Line     int
+	Patterns []string
+}
+
+// directiveTranslator rewrites localized //pgo: directives and localized
+// struct tag keys in transpiled source. Both live in comments and raw strings,
+// which the identifier pass leaves untouched. It keeps its place between
+// calls, so a stream can be translated chunk by chunk.
+//
+// Like //go: directives, a //pgo: directive must start its line. A
+// //pgo:build line is only allowed in the file header, before the package
+// clause; elsewhere it is reported as misplaced, as go vet does for
+// //go:build.
+//
+// Struct tags are only translated in struct bodies, which the translator
+// tells apart from other braces the way DetectDirection does.
+type directiveTranslator struct {
+	maps     Maps
+	line     int    // line number of the next input, for error messages
+	inHeader bool   // no token of the package clause seen yet
+	braces   []bool // the open braces; true for struct bodies
+}
+
+func newDirectiveTranslator(maps Maps) *directiveTranslator {
+	return &directiveTranslator{maps: maps, line: 1, inHeader: true}
+}
+
+// translateDirectives translates a whole file.
+func translateDirectives(src []byte, maps Maps) ([]byte, error) {
+	return newDirectiveTranslator(maps).translate(src)
+}
+
+// translate translates the next part of a file, which must end at a line end
+// outside comments and raw strings.
+func (d *directiveTranslator) translate(src []byte) ([]byte, error) {
+	firstLine := d.line
+	d.line += bytes.Count(src, []byte("\n"))
+	maps := d.maps
+	if len(maps.LocalDirectives) == 0 && len(maps.LocalStructTags) == 0 && !bytes.Contains(src, []byte(pgoBuildPrefix)) {
+		if d.inHeader {
+			d.inHeader = headerOnly(src)
+		}
+		return src, nil
+	}
+	out := make([]byte, 0, len(src))
+	last := 0
+	idx := 0
+	for idx < len(src) {
+		if d.inHeader && !isSpace(src[idx]) && !bytes.HasPrefix(src[idx:], []byte("//")) && !bytes.HasPrefix(src[idx:], []byte("/*")) {
+			d.inHeader = false
+		}
+		switch src[idx] {
+		case '/':
+			if idx+1 < len(src) && src[idx+1] == '/' {
+				end := skipLineComment(src, idx)
+				if bytes.HasPrefix(src[idx:], []byte(pgoDirectivePrefix)) {
+					nameStart := idx + len(pgoDirectivePrefix)
+					nameEnd := nameStart
+					for nameEnd < end && !isSpace(src[nameEnd]) {
+						nameEnd++
+					}
+					name := string(src[nameStart:nameEnd])
+					line := firstLine + lineAt(src, idx) - 1
+					lineStart := bytes.LastIndexByte(src[:idx], '\n') + 1
+					switch {
+					case name == "build":
+						if !d.inHeader || len(bytes.TrimLeft(src[lineStart:idx], " \t")) > 0 {
+							return nil, fmt.Errorf("line %d: misplaced //pgo:build comment", line)
+						}
+						// The leading constraint block is translated before
+						// the body; this one follows other comments.
+						lineEnd := idx + len(bytes.TrimRight(src[idx:end], "\r\n"))
+						expr, err := translateBuildExpr(string(src[nameEnd:lineEnd]), maps)
+						if err != nil {
+							return nil, fmt.Errorf("line %d: %w", line, err)
+						}
+						out = append(out, src[last:idx]...)
+						out = append(out, goBuildPrefix+" "+expr...)
+						last = lineEnd
+					case lineStart != idx:
+						// Not a directive, only a comment mentioning one.
+					default:
+						mapped, ok := maps.LocalDirectives[name]
+						if !ok {
+							return nil, fmt.Errorf("line %d: unknown directive //pgo:%s", line, name)
+						}
+						out = append(out, src[last:idx]...)
+						out = append(out, "//go:"+mapped...)
+						last = nameEnd
+					}
+				}
+				idx = end
+				continue
+			}
+			if idx+1 < len(src) && src[idx+1] == '*' {
+				idx = skipBlockComment(src, idx)
+				continue
+			}
+		case '"':
+			idx = skipInterpretedString(src, idx)
+			continue
+		case '\'':
+			idx = skipRuneLiteral(src, idx)
+			continue
+		case '{':
+			d.braces = append(d.braces, followsWord(src[:idx], "struct"))
+		case '}':
+			if len(d.braces) > 0 {
+				d.braces = d.braces[:len(d.braces)-1]
+			}
+		case '`':
+			end := skipRawString(src, idx)
+			inStruct := len(d.braces) > 0 && d.braces[len(d.braces)-1]
+			if end-idx >= 2 && len(maps.LocalStructTags) > 0 && inStruct && bytes.IndexByte(src[idx:end], ':') >= 0 && followsFieldType(src, idx) {
+				if tag, ok := translateStructTag(string(src[idx+1:end-1]), maps); ok {
+					out = append(out, src[last:idx+1]...)
+					out = append(out, tag...)
+					last = end - 1
+				}
+			}
+			idx = end
+			continue
+		}
+		idx++
+	}
+	out = append(out, src[last:]...)
+	return out, nil
+}
+
+// headerOnly reports whether src holds nothing but blanks and comments.
+func headerOnly(src []byte) bool {
+	idx := 0
+	for idx < len(src) {
+		switch {
+		case isSpace(src[idx]):
+			idx++
+		case bytes.HasPrefix(src[idx:], []byte("//")):
+			idx = skipLineComment(src, idx)
+		case bytes.HasPrefix(src[idx:], []byte("/*")):
+			idx = skipBlockComment(src, idx)
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AddLineDirective prefixes the package clause of transpiled Go source with
+// a /*line*/ directive naming file, the .p.go source. Lines map one to one,
+// so debug info and stack traces then refer to the localized file. The
+// directive goes after any build constraint, which must stay in front.
+func AddLineDirective(gen []byte, file string) []byte {
+	idx := 0
+	for idx < len(gen) {
+		if isSpace(gen[idx]) {
+			idx++
+		} else if bytes.HasPrefix(gen[idx:], []byte("//")) {
+			idx = skipLineComment(gen, idx)
+		} else if bytes.HasPrefix(gen[idx:], []byte("/*")) {
+			idx = skipBlockComment(gen, idx)
+		} else {
+			break
+		}
+	}
+	lineStart := bytes.LastIndexByte(gen[:idx], '\n') + 1
+	directive := fmt.Sprintf("%s%s:%d:%d*/", lineDirectivePrefix, file, lineAt(gen, idx), idx-lineStart+1)
+	out := make([]byte, 0, len(gen)+len(directive))
+	out = append(out, gen[:idx]...)
+	out = append(out, directive...)
+	return append(out, gen[idx:]...)
+}
+
+// followsFieldType reports whether the literal at start sits where a struct
+// tag does: right after a field type on the same line.
+func followsFieldType(src []byte, start int) bool {
+	prefix := bytes.TrimRight(src[:start], " \t")
+	r, size := utf8.DecodeLastRune(prefix)
+	if size == 0 {
+		return false
+	}
+	if r == ']' || r == ')' || r == '}' {
+		return true
+	}
+	word := lastWord(prefix)
+	return word != "" && !token.IsKeyword(word)
+}
+
+// followsWord reports whether src ends in word, followed by blanks only.
+func followsWord(src []byte, word string) bool {
+	return lastWord(bytes.TrimRight(src, " \t\r\n")) == word
+}
+
+// lastWord returns the identifier src ends with, if any.
+func lastWord(src []byte) string {
+	start := len(src)
+	for start > 0 {
+		r, size := utf8.DecodeLastRune(src[:start])
+		if !isIdentPart(r) {
+			break
+		}
+		start -= size
+	}
+	return string(src[start:])
+}
+
+// translateStructTag rewrites localized keys of a conventional struct tag
+// (key:"value" pairs separated by spaces). Anything else is left alone.
+func translateStructTag(tag string, maps Maps) (string, bool) {
+	if len(maps.LocalStructTags) == 0 {
+		return "", false
+	}
+	var b strings.Builder
+	changed := false
+	rest := tag
+	for rest != "" {
+		trimmed := strings.TrimLeft(rest, " ")
+		b.WriteString(rest[:len(rest)-len(trimmed)])
+		rest = trimmed
+		if rest == "" {
+			break
+		}
+		colon := strings.Index(rest, ":")
+		if colon <= 0 || strings.ContainsAny(rest[:colon], " \"`\t\n") || colon+1 >= len(rest) || rest[colon+1] != '"' {
+			return "", false
+		}
+		key := rest[:colon]
+		value, err := strconv.QuotedPrefix(rest[colon+1:])
+		if err != nil {
+			return "", false
+		}
+		if mapped, ok := maps.LocalStructTags[key]; ok {
+			key = mapped
+			changed = true
+		}
+		b.WriteString(key)
+		b.WriteString(":")
+		b.WriteString(value)
+		rest = rest[colon+1+len(value):]
+	}
+	return b.String(), changed
+}
+
+// EmbedPatterns returns the //go:embed directives of Go source.
+func EmbedPatterns(src []byte) ([]EmbedDirective, error) {
+	var directives []EmbedDirective
+	const prefix = "//go:embed"
+	idx := 0
+	for idx < len(src) {
+		switch src[idx] {
+		case '/':
+			if idx+1 < len(src) && src[idx+1] == '/' {
+				end := skipLineComment(src, idx)
+				line := strings.TrimRight(string(src[idx:end]), "\r\n")
+				if strings.HasPrefix(line, prefix) && (len(line) == len(prefix) || isSpace(line[len(prefix)])) {
+					patterns, err := splitEmbedPatterns(line[len(prefix):])
+					if err != nil {
+						return nil, fmt.Errorf("line %d: %w", lineAt(src, idx), err)
+					}
+					directives = append(directives, EmbedDirective{Line: lineAt(src, idx), Patterns: patterns})
+				}
+				idx = end
+				continue
+			}
+			if idx+1 < len(src) && src[idx+1] == '*' {
+				idx = skipBlockComment(src, idx)
+				continue
+			}
+		case '"':
+			idx = skipInterpretedString(src, idx)
+			continue
+		case '\'':
+			idx = skipRuneLiteral(src, idx)
+			continue
+		case '`':
+			idx = skipRawString(src, idx)
+			continue
+		}
+		idx++
+	}
+	return directives, nil
+}
+
+func splitEmbedPatterns(args string) ([]string, error) {
+	var patterns []string
+	rest := strings.TrimSpace(args)
+	for rest != "" {
+		var pattern string
+		switch rest[0] {
+		case '"', '`':
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted embed pattern in %q", args)
+			}
+			pattern, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+		default:
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			pattern = rest[:end]
+			rest = rest[end:]
+		}
+		patterns = append(patterns, pattern)
+		rest = strings.TrimSpace(rest)
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("missing embed pattern")
+	}
+	return patterns, nil
+}
+
+func lineAt(src []byte, offset int) int {
+	return bytes.Count(src[:offset], []byte("\n")) + 1
+}
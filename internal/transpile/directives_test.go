@@ -0,0 +1,157 @@
+package transpile
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirectivePlacement(t *testing.T) {
+	defer func(size int) { streamChunkSize = size }(streamChunkSize)
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src, want string
+	}{
+		{
+			"প্যাকেজ main\n\n//pgo:ইনলাইন_নয়\nফাংশন f() {}\n",
+			"package main\n\n//go:noinline\nfunc f() {}\n",
+		},
+		// Only a comment starting a line is a directive.
+		{
+			"প্যাকেজ main\n\nফাংশন f() {} //pgo:ইনলাইন_নয়\n\t//pgo:অজানা\n/* //pgo:ইনলাইন_নয় */\n",
+			"package main\n\nfunc f() {} //pgo:ইনলাইন_নয়\n\t//pgo:অজানা\n/* //pgo:ইনলাইন_নয় */\n",
+		},
+		{
+			"প্যাকেজ main\n\nচলক s = \"//pgo:অজানা\"\n",
+			"package main\n\nvar s = \"//pgo:অজানা\"\n",
+		},
+		// A constraint may follow other header comments.
+		{
+			"// Copyright\n\n//pgo:build লিনাক্স\n\n/* doc */\nপ্যাকেজ main\n",
+			"// Copyright\n\n//go:build linux\n\n/* doc */\npackage main\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := TranspileFileLocalizedToGo("x.p.go", []byte(tt.src), maps)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%q:\n%s\nwant:\n%s", tt.src, got, tt.want)
+		}
+		for _, size := range []int{1, 64 << 10} {
+			streamChunkSize = size
+			checkStream(t, "x.p.go", []byte(tt.src), []byte(tt.want), maps, LocalToGo)
+		}
+	}
+
+	misplaced := []struct {
+		src, err string
+	}{
+		{"প্যাকেজ main\n\n//pgo:build লিনাক্স\n", "line 3: misplaced //pgo:build comment"},
+		{"প্যাকেজ main\n\nফাংশন f() {} //pgo:build লিনাক্স\n", "line 3: misplaced //pgo:build comment"},
+		{"/* x */ //pgo:build লিনাক্স\n\nপ্যাকেজ main\n", "line 1: misplaced //pgo:build comment"},
+		{"প্যাকেজ main\n\n//pgo:অজানা\n", "line 3: unknown directive //pgo:অজানা"},
+		{"// Copyright\n\n//pgo:build অজানা\n\nপ্যাকেজ main\n", `line 3: unknown build tag "অজানা"`},
+	}
+	for _, tt := range misplaced {
+		_, err := TranspileFileLocalizedToGo("x.p.go", []byte(tt.src), maps)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want %q", tt.src, err, tt.err)
+		}
+		for _, size := range []int{1, 64 << 10} {
+			streamChunkSize = size
+			var out bytes.Buffer
+			err := TranspileStream(&out, strings.NewReader(tt.src), "x.p.go", maps, LocalToGo)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("stream %q (chunk %d): error %v, want %q", tt.src, size, err, tt.err)
+			}
+		}
+	}
+}
+
+func TestAddLineDirective(t *testing.T) {
+	tests := []struct {
+		gen, want string
+		line, col int
+	}{
+		{"package p\n", "/*line x.p.go:1:1*/package p\n", 1, 1},
+		{"//go:build linux\n\npackage p\n", "//go:build linux\n\n/*line x.p.go:3:1*/package p\n", 3, 1},
+		{"// Copyright\n\n//go:build linux\n// +build linux\n\n// Doc.\npackage p\n", "// Copyright\n\n//go:build linux\n// +build linux\n\n// Doc.\n/*line x.p.go:7:1*/package p\n", 7, 1},
+		{"/* ক */ package p\n", "/* ক */ /*line x.p.go:1:11*/package p\n", 1, 11},
+		{"/* a\n b */\tpackage p\n", "/* a\n b */\t/*line x.p.go:2:7*/package p\n", 2, 7},
+	}
+	for _, tt := range tests {
+		got := AddLineDirective([]byte(tt.gen), "x.p.go")
+		if string(got) != tt.want {
+			t.Errorf("AddLineDirective(%q) = %q, want %q", tt.gen, got, tt.want)
+			continue
+		}
+		// The package clause keeps its position, now in the .p.go file.
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "x_p.go", got, parser.PackageClauseOnly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pos := fset.Position(f.Package)
+		if pos.Filename != "x.p.go" || pos.Line != tt.line || pos.Column != tt.col {
+			t.Errorf("%q: package clause at %s, want x.p.go:%d:%d", tt.gen, pos, tt.line, tt.col)
+		}
+	}
+}
+
+func TestStructTagPlacement(t *testing.T) {
+	defer func(size int) { streamChunkSize = size }(streamChunkSize)
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src, want string
+	}{
+		{
+			"প্যাকেজ p\n\nধরণ T কাঠামো {\n\tA লেখা `জেসন:\"a\"`\n\tB কাঠামো{ C লেখা `জেসন:\"c\"` } `জেসন:\"b\"`\n}\n",
+			"package p\n\ntype T struct {\n\tA string `json:\"a\"`\n\tB struct{ C string `json:\"c\"` } `json:\"b\"`\n}\n",
+		},
+		// Raw strings outside struct bodies are no tags.
+		{
+			"প্যাকেজ p\n\nফাংশন f() লেখা {\n\tফেরত `জেসন:\"x\"`\n}\n",
+			"package p\n\nfunc f() string {\n\treturn `জেসন:\"x\"`\n}\n",
+		},
+		{
+			"প্যাকেজ p\n\nচলক s = `জেসন:\"x\"`\n",
+			"package p\n\nvar s = `জেসন:\"x\"`\n",
+		},
+		{
+			"প্যাকেজ p\n\nফাংশন f() {\n\tg(A, `জেসন:\"x\"`)\n}\n",
+			"package p\n\nfunc f() {\n\tg(A, `জেসন:\"x\"`)\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := TranspileFileLocalizedToGo("x.p.go", []byte(tt.src), maps)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%q:\n%s\nwant:\n%s", tt.src, got, tt.want)
+		}
+		for _, size := range []int{1, 64 << 10} {
+			streamChunkSize = size
+			checkStream(t, "x.p.go", []byte(tt.src), []byte(tt.want), maps, LocalToGo)
+		}
+	}
+
+	for _, prefix := range []string{"return", "x =", "x :=", "case"} {
+		if followsFieldType([]byte(prefix+" `json:\"x\"`"), len(prefix)+1) {
+			t.Errorf("followsFieldType after %q", prefix)
+		}
+	}
+}
@@ -35,7 +35,7 @@ func TestGoldenTranspile(t *testing.T) {
 				t.Fatalf("read input %s: %v", path, err)
 			}
 
-			got, err := TranspileFile(path, src, maps)
+			got, err := TranspileFile(path, src, maps, AutoDirection)
 			if err != nil {
 				t.Fatalf("TranspileFile(%s): %v", path, err)
 			}
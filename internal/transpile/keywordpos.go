@@ -0,0 +1,223 @@
+package transpile
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// LocalizedKeyword is a localized keyword used where Go expects a keyword.
+type LocalizedKeyword struct {
+	// Line and Column are 1-based; Column counts bytes, as in go/token.
+	Line, Column int
+	Word         string
+	Keyword      string
+}
+
+// FindLocalizedKeywords returns the localized keywords of a Go file that sit
+// in keyword positions, so files written in the localized language can be
+// told apart from Go files that merely use a localized word as a name (para,
+// tipo, caso, ...). Predeclared names are identifiers in Go as well and are
+// not reported.
+//
+// A word counts as a keyword when no identifier could stand there: at the
+// start of a top-level declaration, directly after a closing brace on the
+// same line (the place of else), or at the start of a statement when the next
+// token cannot follow a name there, as in "si x > 0 {" or a bare "romper".
+func FindLocalizedKeywords(src []byte, maps Maps) []LocalizedKeyword {
+	toks := scanKeywordTokens(src)
+	var found []LocalizedKeyword
+	report := func(t keywordToken, keyword string) {
+		line := 1 + bytes.Count(src[:t.off], []byte("\n"))
+		col := t.off - bytes.LastIndexByte(src[:t.off], '\n')
+		found = append(found, LocalizedKeyword{Line: line, Column: col, Word: t.text, Keyword: keyword})
+	}
+
+	// stack holds the open brackets: '(', '[', '{' for blocks and composite
+	// literals, and 's' for struct and interface bodies.
+	var stack []byte
+	top := func() byte {
+		if len(stack) == 0 {
+			return 0
+		}
+		return stack[len(stack)-1]
+	}
+	// The header of if, for and switch ends at the "{" of its block; its
+	// semicolons do not start statements.
+	header, headerDepth := false, 0
+
+	for i, t := range toks {
+		var prev, next keywordToken
+		if i > 0 {
+			prev = toks[i-1]
+		}
+		if i+1 < len(toks) {
+			next = toks[i+1]
+		}
+		inHeader := header && len(stack) == headerDepth
+		stmtStart := i == 0 || prev.kind == kwNewline ||
+			(prev.text == ";" || prev.text == ":") && !inHeader ||
+			prev.text == "{" && top() == '{'
+
+		switch t.kind {
+		case kwIdent:
+			_, identity := maps.Identity[t.text]
+			if keyword, ok := maps.LocalToGo[t.text]; ok && !identity {
+				switch {
+				case len(stack) == 0 && stmtStart:
+					report(t, keyword)
+				case top() == '{' && stmtStart && !inHeader && !followsName[next.text]:
+					report(t, keyword)
+				case prev.kind == kwPunct && prev.text == "}":
+					report(t, keyword)
+				}
+			}
+			if t.text == "if" || t.text == "for" || t.text == "switch" {
+				header, headerDepth = true, len(stack)
+			}
+		case kwPunct:
+			switch t.text {
+			case "(", "[":
+				stack = append(stack, t.text[0])
+			case "{":
+				if prev.text == "struct" || prev.text == "interface" {
+					stack = append(stack, 's')
+				} else {
+					stack = append(stack, '{')
+				}
+				if inHeader {
+					header = false
+				}
+			case ")", "]", "}":
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+		}
+	}
+	return found
+}
+
+// followsName holds the tokens that can follow a name at the start of a
+// statement: assignments, selectors, calls, indexes, labels, sends, and the
+// end of a composite literal element.
+var followsName = map[string]bool{
+	":=": true, "=": true, "+=": true, "-=": true, "*=": true, "/=": true, "%=": true,
+	"&=": true, "|=": true, "^=": true, "<<=": true, ">>=": true, "&^=": true,
+	",": true, ".": true, "(": true, "[": true, "++": true, "--": true,
+	":": true, "<-": true, ")": true, "}": true,
+}
+
+type keywordTokenKind int
+
+const (
+	kwIdent keywordTokenKind = iota + 1
+	kwLiteral
+	kwPunct
+	// kwNewline is a newline that ends a statement, see the Go spec on
+	// semicolons.
+	kwNewline
+)
+
+type keywordToken struct {
+	kind keywordTokenKind
+	text string
+	off  int
+}
+
+// operators lists the Go operators longer than one byte, longest first.
+var operators = []string{
+	"<<=", ">>=", "&^=", "...",
+	"&&", "||", "<-", "++", "--", "==", "!=", "<=", ">=", ":=",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "<<", ">>", "&^",
+}
+
+// scanKeywordTokens splits src into tokens, dropping comments and the
+// newlines that do not end a statement.
+func scanKeywordTokens(src []byte) []keywordToken {
+	var toks []keywordToken
+	endsStatement := func() bool {
+		if len(toks) == 0 {
+			return false
+		}
+		last := toks[len(toks)-1]
+		switch last.kind {
+		case kwIdent, kwLiteral:
+			return true
+		case kwPunct:
+			switch last.text {
+			case ")", "]", "}", "++", "--":
+				return true
+			}
+		}
+		return false
+	}
+	newline := func(off int) {
+		if endsStatement() {
+			toks = append(toks, keywordToken{kind: kwNewline, off: off})
+		}
+	}
+
+	idx := 0
+	for idx < len(src) {
+		c := src[idx]
+		switch {
+		case c == '\n':
+			newline(idx)
+			idx++
+			continue
+		case isSpace(c):
+			idx++
+			continue
+		case c == '/' && idx+1 < len(src) && src[idx+1] == '/':
+			idx = skipLineComment(src, idx)
+			newline(idx - 1)
+			continue
+		case c == '/' && idx+1 < len(src) && src[idx+1] == '*':
+			end := skipBlockComment(src, idx)
+			if bytes.IndexByte(src[idx:end], '\n') >= 0 {
+				newline(idx)
+			}
+			idx = end
+			continue
+		case c == '"' || c == '\'' || c == '`':
+			end := skipRawString(src, idx)
+			if c == '"' {
+				end = skipInterpretedString(src, idx)
+			} else if c == '\'' {
+				end = skipRuneLiteral(src, idx)
+			}
+			toks = append(toks, keywordToken{kind: kwLiteral, text: string(src[idx:end]), off: idx})
+			idx = end
+			continue
+		case c >= '0' && c <= '9' || c == '.' && idx+1 < len(src) && src[idx+1] >= '0' && src[idx+1] <= '9':
+			end := readNumber(src, idx)
+			toks = append(toks, keywordToken{kind: kwLiteral, text: string(src[idx:end]), off: idx})
+			idx = end
+			continue
+		}
+
+		r, size := utf8.DecodeRune(src[idx:])
+		if isDigit(r) {
+			end := readNumber(src, idx)
+			toks = append(toks, keywordToken{kind: kwLiteral, text: string(src[idx:end]), off: idx})
+			idx = end
+			continue
+		}
+		if isIdentStart(r) {
+			end := readIdent(src, idx)
+			toks = append(toks, keywordToken{kind: kwIdent, text: string(src[idx:end]), off: idx})
+			idx = end
+			continue
+		}
+		text := string(src[idx : idx+size])
+		for _, op := range operators {
+			if bytes.HasPrefix(src[idx:], []byte(op)) {
+				text = op
+				break
+			}
+		}
+		toks = append(toks, keywordToken{kind: kwPunct, text: text, off: idx})
+		idx += len(text)
+	}
+	return toks
+}
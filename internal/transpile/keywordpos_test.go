@@ -0,0 +1,55 @@
+package transpile
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFindLocalizedKeywords(t *testing.T) {
+	es, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "es.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bn, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Go files that use localized words as names.
+	clean := []string{
+		"package x\n\nvar para, tipo int\n\nfunc f(caso int) (mapa map[string]int) {\n\tpara = caso\n\tpara++\n\ttipo := []int{para}\n\tfor i := 0; para < 3; i++ {\n\t\tpara += tipo[0]\n\t}\n\tif x := f(1); caso > 0 {\n\t\t_ = x\n\t}\n\tmapa[\"si\"] = len(tipo)\n\treturn\n}\n",
+		"package x\n\ntype T struct {\n\tpara int\n\ttipo string\n}\n\nvar v = T{para: 1, tipo: \"x\"}\n\nfunc g() {\n\tnuevo := make(chan int)\n\tnuevo <- 1\n\tsi: for {\n\t\tbreak si\n\t}\n}\n",
+		"package x\n\n// si x > 0 { romper }\nvar s = `para i := rango xs {`\n\nfunc real() error { return nil }\n",
+	}
+	for _, src := range clean {
+		if found := FindLocalizedKeywords([]byte(src), es); len(found) != 0 {
+			t.Errorf("FindLocalizedKeywords(%q) = %+v, want none", src, found)
+		}
+	}
+
+	tests := []struct {
+		src  string
+		maps Maps
+		want []LocalizedKeyword
+	}{
+		{"paquete x\n", es, []LocalizedKeyword{{1, 1, "paquete", "package"}}},
+		{"package x\n\nfuncion f() {}\n", es, []LocalizedKeyword{{3, 1, "funcion", "func"}}},
+		{"package x\n\nfunc f(x int) int {\n\tsi x > 0 {\n\t\tretornar x\n\t} sino {\n\t\tromper\n\t}\n\treturn 0\n}\n", es, []LocalizedKeyword{
+			{4, 2, "si", "if"}, {5, 3, "retornar", "return"}, {6, 4, "sino", "else"}, {7, 3, "romper", "break"},
+		}},
+		{"package x\n\nfunc f() {\n\tpara i := rango xs {\n\t}\n}\n", es, []LocalizedKeyword{{4, 2, "para", "for"}}},
+		{"প্যাকেজ x\n", bn, []LocalizedKeyword{{1, 1, "প্যাকেজ", "package"}}},
+	}
+	for _, tt := range tests {
+		found := FindLocalizedKeywords([]byte(tt.src), tt.maps)
+		if len(found) != len(tt.want) {
+			t.Errorf("FindLocalizedKeywords(%q) = %+v, want %+v", tt.src, found, tt.want)
+			continue
+		}
+		for i := range found {
+			if found[i] != tt.want[i] {
+				t.Errorf("FindLocalizedKeywords(%q)[%d] = %+v, want %+v", tt.src, i, found[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package transpile
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// digitValue returns the value of a decimal digit of any script (Unicode
+// category Nd), or -1. Unicode allocates such digits in runs of ten from
+// zero.
+func digitValue(r rune) int {
+	if r >= '0' && r <= '9' {
+		return int(r - '0')
+	}
+	if r < utf8.RuneSelf || !unicode.IsDigit(r) {
+		return -1
+	}
+	for _, rng := range unicode.Nd.R16 {
+		if r >= rune(rng.Lo) && r <= rune(rng.Hi) {
+			return int(r-rune(rng.Lo)) % 10
+		}
+	}
+	for _, rng := range unicode.Nd.R32 {
+		if r >= rune(rng.Lo) && r <= rune(rng.Hi) {
+			return int(r-rune(rng.Lo)) % 10
+		}
+	}
+	return -1
+}
+
+func isDigit(r rune) bool {
+	return digitValue(r) >= 0
+}
+
+// parseDigits validates the digits section of a keyword map: the ten digits
+// of one script, zero to nine.
+func parseDigits(s string) ([]rune, error) {
+	if s == "" {
+		return nil, nil
+	}
+	digits := []rune(s)
+	if len(digits) != 10 {
+		return nil, fmt.Errorf("digits %q: want the ten digits 0 to 9", s)
+	}
+	for i, r := range digits {
+		if digitValue(r) != i {
+			return nil, fmt.Errorf("digits %q: %q is not the digit %d", s, r, i)
+		}
+	}
+	return digits, nil
+}
+
+// readNumber returns the end of the number literal that starts at start
+// with a digit, or a '.' before one. Digits may be those of any script;
+// prefixes, hex digits, exponents and the imaginary suffix are ASCII.
+func readNumber(src []byte, start int) int {
+	hex := false
+	if r, size := utf8.DecodeRune(src[start:]); digitValue(r) == 0 && start+size < len(src) {
+		hex = src[start+size] == 'x' || src[start+size] == 'X'
+	}
+	idx := start
+	for idx < len(src) {
+		r, size := utf8.DecodeRune(src[idx:])
+		switch {
+		case isDigit(r) || r == '_':
+		case r < utf8.RuneSelf && isASCIILetter(byte(r)):
+		case r == '.':
+			// A dot followed by a name is a selector, as in s[0].x.
+			next, _ := utf8.DecodeRune(src[idx+1:])
+			if isIdentStart(next) && !isExponent(src[idx+1:], hex) {
+				return idx
+			}
+		case (r == '+' || r == '-') && idx > start && isExponent(src[idx-1:idx], hex):
+		default:
+			return idx
+		}
+		idx += size
+	}
+	return idx
+}
+
+// isExponent reports whether b starts with an exponent letter: e or E in
+// decimal literals, p or P in hex ones. After a dot the letter must be
+// followed by a digit or sign to count, so 1.e5 is a float and s[0].e a
+// selector.
+func isExponent(b []byte, hex bool) bool {
+	if len(b) == 0 {
+		return false
+	}
+	switch b[0] {
+	case 'e', 'E':
+		if hex {
+			return false
+		}
+	case 'p', 'P':
+		if !hex {
+			return false
+		}
+	default:
+		return false
+	}
+	if len(b) == 1 {
+		return true
+	}
+	r, _ := utf8.DecodeRune(b[1:])
+	return isDigit(r) || r == '+' || r == '-'
+}
+
+// appendNumber appends the number literal lit for direction. Going to Go,
+// digits of other scripts become ASCII. Going to the localized language,
+// decimal literals get the map's digits when maps.LocalizeDigits is set;
+// hex, octal and binary literals stay ASCII, as their letters would.
+func appendNumber(out, lit []byte, maps Maps, direction Direction) []byte {
+	if direction == LocalToGo {
+		if isASCII(lit) {
+			return append(out, lit...)
+		}
+		for _, r := range string(lit) {
+			if v := digitValue(r); v >= 0 {
+				r = rune('0' + v)
+			}
+			out = utf8.AppendRune(out, r)
+		}
+		return out
+	}
+	if !maps.LocalizeDigits || len(maps.digits) == 0 || hasBasePrefix(lit) {
+		return append(out, lit...)
+	}
+	for _, c := range lit {
+		if c >= '0' && c <= '9' {
+			out = utf8.AppendRune(out, maps.digits[c-'0'])
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// hasBasePrefix reports whether the ASCII literal lit starts with 0x, 0o or
+// 0b.
+func hasBasePrefix(lit []byte) bool {
+	if len(lit) < 2 || lit[0] != '0' {
+		return false
+	}
+	switch lit[1] {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
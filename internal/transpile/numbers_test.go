@@ -0,0 +1,94 @@
+package transpile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLocalizedNumbers(t *testing.T) {
+	data, _ := EmbeddedKeywordMap("bn")
+	maps, err := LoadKeywordMapData(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"১২৩":       "123",
+		"০x১F":      "0x1F",
+		"০X১e+২":    "0X1e+2",
+		"৪.৫e-৬":    "4.5e-6",
+		"০x১.৮p+৩":  "0x1.8p+3",
+		"০b১০১":     "0b101",
+		"০o৭৭":      "0o77",
+		"১_০০০":     "1_000",
+		"৩i":        "3i",
+		".৫":        ".5",
+		"১.":        "1.",
+		"s[০].x":    "s[0].x",
+		"s[০].e":    "s[0].e",
+		"१२":        "12", // Devanagari
+		"٣٤":        "34", // Arabic-Indic
+		"１０":        "10", // full-width
+		"x১ + ২":    "x১ + 2",
+		`"১" + '২'`: `"১" + '২'`,
+	}
+	for src, want := range tests {
+		in := []byte("প্যাকেজ p\n\nচলক _ = " + src + "\n")
+		for _, direction := range []Direction{LocalToGo, AutoDirection} {
+			out, err := TranspileFile("x.p.go", in, maps, direction)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimPrefix(strings.TrimSpace(string(out)), "package p\n\nvar _ = "); got != want {
+				t.Errorf("%q (direction %v) = %q, want %q", src, direction, got, want)
+			}
+		}
+		out, err := TranspileFileLocalizedToGo("x.p.go", in, maps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimPrefix(strings.TrimSpace(string(out)), "package p\n\nvar _ = "); got != want {
+			t.Errorf("strict %q = %q, want %q", src, got, want)
+		}
+	}
+
+	// Go to local keeps ASCII digits unless asked, and then only localizes
+	// decimal literals.
+	src := []byte("package p\n\nvar x = 10 + 0x1F + 2.5e3\n")
+	out, err := TranspileFileGoToLocal("x.go", src, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "10 + 0x1F + 2.5e3") {
+		t.Errorf("digits were localized without LocalizeDigits:\n%s", out)
+	}
+	maps.LocalizeDigits = true
+	out, err = TranspileFileGoToLocal("x.go", src, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "১০ + 0x1F + ২.৫e৩") {
+		t.Errorf("localized digits:\n%s", out)
+	}
+	back, err := TranspileFileLocalizedToGo("x.p.go", out, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back) != string(src) {
+		t.Errorf("round trip changed the source:\n%s", back)
+	}
+}
+
+func TestDigitsSection(t *testing.T) {
+	for _, bad := range []string{"০১২", "০১২৩৪৫৬৭৯৮", "abcdefghij"} {
+		if _, err := LoadKeywordMapData([]byte(`{"digits": "`+bad+`"}`), false); err == nil {
+			t.Errorf("digits %q accepted", bad)
+		}
+	}
+	maps, err := LoadKeywordMapData([]byte(`{"digits": "٠١٢٣٤٥٦٧٨٩"}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(maps.digits) != 10 {
+		t.Errorf("digits = %q", maps.digits)
+	}
+}
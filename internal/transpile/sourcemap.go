@@ -0,0 +1,105 @@
+package transpile
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Span is a part of a line that transpiling replaced. Lines are the same in
+// the source and the generated file; columns are 1-based byte offsets in the
+// line, and offsets 0-based byte offsets in the file.
+type Span struct {
+	Line      int `json:"line"`
+	GenColumn int `json:"gen_col"`
+	GenLength int `json:"gen_len"`
+	GenOffset int `json:"gen_offset"`
+	SrcColumn int `json:"src_col"`
+	SrcLength int `json:"src_len"`
+	SrcOffset int `json:"src_offset"`
+}
+
+// ReplacedSpans returns the spans of gen that differ from src, its
+// localized source, in source order. Transpiling keeps lines one to one and
+// only swaps words (keywords, identifiers, directive names, tag keys), so
+// the lines are aligned word by word. If a line cannot be aligned, the rest
+// of it is returned as a single span. A /*line*/ directive added by
+// AddLineDirective is skipped, so gen may be the final output.
+func ReplacedSpans(src, gen []byte) []Span {
+	var spans []Span
+	line := 1
+	srcOffset, genOffset := 0, 0
+	for len(src) > 0 || len(gen) > 0 {
+		srcLine, srcRest := cutLine(src)
+		genLine, genRest := cutLine(gen)
+		first := len(spans)
+		spans = appendLineSpans(spans, line, srcLine, genLine)
+		for k := first; k < len(spans); k++ {
+			spans[k].SrcOffset = srcOffset + spans[k].SrcColumn - 1
+			spans[k].GenOffset = genOffset + spans[k].GenColumn - 1
+		}
+		srcOffset += len(src) - len(srcRest)
+		genOffset += len(gen) - len(genRest)
+		src, gen = srcRest, genRest
+		line++
+	}
+	return spans
+}
+
+// lineDirectivePrefix starts the directive of AddLineDirective.
+var lineDirectivePrefix = []byte("/*line ")
+
+func cutLine(b []byte) ([]byte, []byte) {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+	return b, nil
+}
+
+func appendLineSpans(spans []Span, line int, src, gen []byte) []Span {
+	i, j := 0, 0
+	for i < len(src) && j < len(gen) {
+		if bytes.HasPrefix(gen[j:], lineDirectivePrefix) && !bytes.HasPrefix(src[i:], lineDirectivePrefix) {
+			if end := bytes.Index(gen[j:], []byte("*/")); end >= 0 {
+				j += end + 2
+				continue
+			}
+		}
+		srcEnd, genEnd := wordEnd(src, i), wordEnd(gen, j)
+		if srcEnd > i || genEnd > j {
+			if !bytes.Equal(src[i:srcEnd], gen[j:genEnd]) {
+				spans = append(spans, Span{Line: line, GenColumn: j + 1, GenLength: genEnd - j, SrcColumn: i + 1, SrcLength: srcEnd - i})
+			}
+			i, j = srcEnd, genEnd
+			continue
+		}
+		if src[i] != gen[j] {
+			break
+		}
+		i++
+		j++
+	}
+	if i < len(src) || j < len(gen) {
+		spans = append(spans, Span{Line: line, GenColumn: j + 1, GenLength: len(gen) - j, SrcColumn: i + 1, SrcLength: len(src) - i})
+	}
+	return spans
+}
+
+// wordEnd returns the end of the word (an identifier, number or @-escaped
+// identifier) starting at start, or start if there is none.
+func wordEnd(b []byte, start int) int {
+	idx := start
+	if idx < len(b) && b[idx] == '@' {
+		idx++
+	}
+	for idx < len(b) {
+		r, size := utf8.DecodeRune(b[idx:])
+		if r == utf8.RuneError && size == 1 || !isIdentPart(r) {
+			break
+		}
+		idx += size
+	}
+	if idx == start+1 && b[start] == '@' {
+		return start
+	}
+	return idx
+}
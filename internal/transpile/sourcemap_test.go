@@ -0,0 +1,105 @@
+package transpile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplacedSpans(t *testing.T) {
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := "প্যাকেজ main\n\nফাংশন main() {\n\tযদি সত্য { // যদি\n\t}\n}\n"
+	gen, err := TranspileFileLocalizedToGo("main.p.go", []byte(src), maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ReplacedSpans([]byte(src), gen)
+	line3 := len("প্যাকেজ main\n\n")
+	line4 := line3 + len("ফাংশন main() {\n")
+	genLine4 := len("package main\n\nfunc main() {\n")
+	want := []Span{
+		{Line: 1, GenColumn: 1, GenLength: 7, GenOffset: 0, SrcColumn: 1, SrcLength: len("প্যাকেজ"), SrcOffset: 0},
+		{Line: 3, GenColumn: 1, GenLength: 4, GenOffset: len("package main\n\n"), SrcColumn: 1, SrcLength: len("ফাংশন"), SrcOffset: line3},
+		{Line: 4, GenColumn: 2, GenLength: 2, GenOffset: genLine4 + 1, SrcColumn: 2, SrcLength: len("যদি"), SrcOffset: line4 + 1},
+		{Line: 4, GenColumn: 5, GenLength: 4, GenOffset: genLine4 + 4, SrcColumn: 2 + len("যদি "), SrcLength: len("সত্য"), SrcOffset: line4 + 1 + len("যদি ")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+
+	// A /*line*/ directive moves what follows it in the generated file.
+	directive := len("/*line main.p.go:1:1*/")
+	for i := range want {
+		want[i].GenOffset += directive
+		if want[i].Line == 1 {
+			want[i].GenColumn += directive
+		}
+	}
+	withDirective := AddLineDirective(gen, "main.p.go")
+	if got := ReplacedSpans([]byte(src), withDirective); !reflect.DeepEqual(got, want) {
+		t.Fatalf("with a line directive: got %+v\nwant %+v", got, want)
+	}
+	for _, span := range want {
+		if string(withDirective[span.GenOffset:span.GenOffset+span.GenLength]) != string(gen[span.GenOffset-directive:span.GenOffset-directive+span.GenLength]) {
+			t.Errorf("%+v does not address the replaced word", span)
+		}
+	}
+}
+
+// Replacing every span of the generated file by its source text must give
+// back the source.
+func TestReplacedSpansRoundTrip(t *testing.T) {
+	repoRoot := filepath.Join("..", "..")
+	testdataRoot := filepath.Join(repoRoot, "testdata")
+	localeSet := mustLocaleSet(filepath.Join(repoRoot, "lang"))
+	err := filepath.WalkDir(testdataRoot, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".p.go") {
+			return err
+		}
+		locale := localeForPath(testdataRoot, path, localeSet)
+		if locale == "" {
+			locale = "bn"
+		}
+		maps, err := LoadKeywordMapData(mustRead(filepath.Join(repoRoot, "lang", locale+".json")), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := mustRead(path)
+		gen, err := TranspileFileLocalizedToGo(path, src, maps)
+		if err != nil {
+			return nil
+		}
+		srcLines := strings.Split(string(src), "\n")
+		genLines := strings.Split(string(gen), "\n")
+		spans := ReplacedSpans(src, gen)
+		for _, span := range spans {
+			// Offsets address the same bytes as line and column.
+			srcText := srcLines[span.Line-1][span.SrcColumn-1 : span.SrcColumn-1+span.SrcLength]
+			genText := genLines[span.Line-1][span.GenColumn-1 : span.GenColumn-1+span.GenLength]
+			if got := string(src[span.SrcOffset : span.SrcOffset+span.SrcLength]); got != srcText {
+				t.Errorf("%s: %+v: source offset gives %q, want %q", path, span, got, srcText)
+			}
+			if got := string(gen[span.GenOffset : span.GenOffset+span.GenLength]); got != genText {
+				t.Errorf("%s: %+v: generated offset gives %q, want %q", path, span, got, genText)
+			}
+		}
+		for i := len(spans) - 1; i >= 0; i-- {
+			span := spans[i]
+			line := genLines[span.Line-1]
+			srcText := srcLines[span.Line-1][span.SrcColumn-1 : span.SrcColumn-1+span.SrcLength]
+			genLines[span.Line-1] = line[:span.GenColumn-1] + srcText + line[span.GenColumn-1+span.GenLength:]
+		}
+		if got := strings.Join(genLines, "\n"); got != string(src) {
+			t.Errorf("%s: spans do not restore the source:\n%s", path, got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,191 @@
+package transpile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// streamChunkSize is how much input TranspileStream collects before
+// transpiling it. Chunks always end on a line break outside block comments
+// and raw strings, so no token is split between them.
+var streamChunkSize = 64 << 10
+
+// TranspileStream transpiles the source read from r and writes the result to
+// w. LocalToGo behaves like TranspileFileLocalizedToGo and GoToLocal like
+// TranspileFileGoToLocal, but only one chunk of input is held in memory:
+// about 64 KiB, or more when a single block comment or raw string is longer.
+// srcPath is used for file-name rules and error messages.
+func TranspileStream(w io.Writer, r io.Reader, srcPath string, maps Maps, direction Direction) error {
+	if direction == AutoDirection {
+		return fmt.Errorf("%s: streams need an explicit direction", srcPath)
+	}
+	if direction == LocalToGo && isTestFile(srcPath, maps) {
+		// Testing method aliases depend on the parameters of the enclosing
+		// function, which a chunk may not include; test files are small.
+		src, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		out, err := TranspileFileLocalizedToGo(srcPath, src, maps)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	}
+	s := &streamer{maps: maps, direction: direction}
+	if direction == LocalToGo {
+		s.localizer = newLocalizer(maps)
+		s.directives = newDirectiveTranslator(maps)
+	}
+
+	br := bufio.NewReaderSize(r, 32<<10)
+	var chunk, out []byte
+	var lex lineLexer
+	lineStart := 0
+	for {
+		part, err := br.ReadSlice('\n')
+		chunk = append(chunk, part...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		eof := err == io.EOF
+		lex.scanLine(chunk[lineStart:])
+		lineStart = len(chunk)
+
+		if eof || (len(chunk) >= streamChunkSize && lex.state == lexCode) {
+			// The build constraint block must be complete before the first
+			// chunk is transpiled.
+			if !s.started && !eof && buildTagPrefixLen(chunk) == len(chunk) {
+				continue
+			}
+			out, err = s.transpile(out[:0], chunk)
+			if err != nil {
+				return fmt.Errorf("%s: %w", srcPath, err)
+			}
+			if _, err := w.Write(out); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+			lineStart = 0
+		}
+		if eof {
+			return nil
+		}
+	}
+}
+
+type streamer struct {
+	maps       Maps
+	direction  Direction
+	localizer  *localizer
+	directives *directiveTranslator
+	compactor  commaCompactor
+	scratch    []byte
+	started    bool
+	offset     int
+}
+
+func (s *streamer) transpile(out, chunk []byte) ([]byte, error) {
+	body := chunk
+	if !s.started {
+		s.started = true
+		prefixLen := buildTagPrefixLen(chunk)
+		prefix := chunk[:prefixLen]
+		if s.direction == LocalToGo {
+			var err error
+			prefix, err = translateBuildPrefix(prefix, s.maps)
+			if err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, prefix...)
+		body = chunk[prefixLen:]
+	}
+
+	var err error
+	if s.direction == LocalToGo {
+		out, err = s.localizer.appendBody(out, body, s.offset+len(chunk)-len(body))
+		if err != nil {
+			return nil, err
+		}
+		// out holds exactly this chunk, which never splits a comment or a
+		// raw string, so directives can be rewritten chunk by chunk.
+		out, err = s.directives.translate(out)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		s.scratch, err = appendTranspiledBody(s.scratch[:0], body, s.offset+len(chunk)-len(body), s.maps)
+		if err != nil {
+			return nil, err
+		}
+		out = s.compactor.appendCompacted(out, s.scratch)
+	}
+	s.offset += len(chunk)
+	return out, nil
+}
+
+type lexState int
+
+const (
+	lexCode lexState = iota
+	lexBlockComment
+	lexRawString
+)
+
+// lineLexer tracks whether the input so far ends inside a block comment or a
+// raw string, the only tokens that span lines.
+type lineLexer struct {
+	state lexState
+}
+
+func (lx *lineLexer) scanLine(line []byte) {
+	idx := 0
+	for idx < len(line) {
+		switch lx.state {
+		case lexBlockComment:
+			end := bytes.Index(line[idx:], []byte("*/"))
+			if end < 0 {
+				return
+			}
+			idx += end + 2
+			lx.state = lexCode
+		case lexRawString:
+			end := bytes.IndexByte(line[idx:], '`')
+			if end < 0 {
+				return
+			}
+			idx += end + 1
+			lx.state = lexCode
+		default:
+			switch line[idx] {
+			case '/':
+				if idx+1 < len(line) && line[idx+1] == '/' {
+					return
+				}
+				if idx+1 < len(line) && line[idx+1] == '*' {
+					lx.state = lexBlockComment
+					idx += 2
+					continue
+				}
+			case '"':
+				idx = skipInterpretedString(line, idx)
+				continue
+			case '\'':
+				idx = skipRuneLiteral(line, idx)
+				continue
+			case '`':
+				lx.state = lexRawString
+				idx++
+				continue
+			}
+			idx++
+		}
+	}
+}
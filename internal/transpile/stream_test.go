@@ -0,0 +1,140 @@
+package transpile
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranspileStream(t *testing.T) {
+	defer func(size int) { streamChunkSize = size }(streamChunkSize)
+
+	repoRoot := filepath.Join("..", "..")
+	testdataRoot := filepath.Join(repoRoot, "testdata")
+	localeSet := mustLocaleSet(filepath.Join(repoRoot, "lang"))
+	err := filepath.WalkDir(testdataRoot, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".p.go") {
+			return err
+		}
+		locale := localeForPath(testdataRoot, path, localeSet)
+		if locale == "" {
+			locale = "bn"
+		}
+		maps, err := LoadKeywordMapData(mustRead(filepath.Join(repoRoot, "lang", locale+".json")), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := mustRead(path)
+		goSrc, err := TranspileFileLocalizedToGo(path, src, maps)
+		if err != nil {
+			return nil // direction-detection fixtures; covered by the golden test
+		}
+		for _, size := range []int{1, 64, 64 << 10} {
+			streamChunkSize = size
+			checkStream(t, path, src, goSrc, maps, LocalToGo)
+			local, err := TranspileFileGoToLocal(path, goSrc, maps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStream(t, path, goSrc, local, maps, GoToLocal)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkStream(t *testing.T, path string, src, want []byte, maps Maps, direction Direction) {
+	t.Helper()
+	var got bytes.Buffer
+	if err := TranspileStream(&got, bytes.NewReader(src), path, maps, direction); err != nil {
+		t.Fatalf("%s (chunk %d): %v", path, streamChunkSize, err)
+	}
+	if got.String() != string(want) {
+		t.Fatalf("%s (chunk %d): stream output differs\n--- GOT ---\n%s\n--- WANT ---\n%s", path, streamChunkSize, got.Bytes(), want)
+	}
+}
+
+func TestTranspileStreamDirectiveLine(t *testing.T) {
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(size int) { streamChunkSize = size }(streamChunkSize)
+	streamChunkSize = 1
+	src := "প্যাকেজ main\n\n/* a\nb */\n//pgo:অজানা\n"
+	err = TranspileStream(new(bytes.Buffer), strings.NewReader(src), "main.p.go", maps, LocalToGo)
+	if err == nil || !strings.Contains(err.Error(), "line 5:") {
+		t.Fatalf("got %v, want an error on line 5", err)
+	}
+}
+
+func benchmarkSource(b *testing.B) ([]byte, []byte, Maps) {
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	src := mustRead(filepath.Join("..", "..", "testdata", "directives", "bn", "main.p.go"))
+	var local bytes.Buffer
+	local.Write(src)
+	unit := src[buildTagPrefixLen(src):]
+	if i := bytes.IndexByte(unit, '\n'); i >= 0 {
+		unit = unit[i+1:] // drop the package clause
+	}
+	for local.Len() < 4<<20 {
+		local.Write(unit)
+	}
+	goSrc, err := TranspileFileLocalizedToGo("main.p.go", local.Bytes(), maps)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return local.Bytes(), goSrc, maps
+}
+
+func BenchmarkTranspileFileLocalizedToGo(b *testing.B) {
+	src, _, maps := benchmarkSource(b)
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := TranspileFileLocalizedToGo("main.p.go", src, maps); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTranspileStreamLocalToGo(b *testing.B) {
+	src, _, maps := benchmarkSource(b)
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := TranspileStream(io.Discard, bytes.NewReader(src), "main.p.go", maps, LocalToGo); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTranspileFileGoToLocal(b *testing.B) {
+	_, src, maps := benchmarkSource(b)
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := TranspileFileGoToLocal("main.go", src, maps); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTranspileStreamGoToLocal(b *testing.B) {
+	_, src, maps := benchmarkSource(b)
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := TranspileStream(io.Discard, bytes.NewReader(src), "main.go", maps, GoToLocal); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package transpile
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TestingMap holds the localized testing idioms of a keyword map. They only
+// apply in test files.
+type TestingMap struct {
+	// Prefixes maps localized function name prefixes to the ones the go tool
+	// discovers (Test, Benchmark, Example, Fuzz), e.g. "পরীক্ষা" → "Test".
+	Prefixes map[string]string `json:"prefixes"`
+	// Methods maps localized selector names to testing methods, e.g.
+	// "ত্রুটি_লেখো" → "Errorf" for t.ত্রুটি_লেখো(...).
+	Methods map[string]string `json:"methods"`
+}
+
+func isTestFile(srcPath string, maps Maps) bool {
+	return strings.HasSuffix(GoFileName(srcPath, maps), "_test.go")
+}
+
+// testFuncName rewrites an identifier that starts with a localized test
+// prefix into a name the go tool recognizes. Most of our scripts are
+// caseless, so the prefix must be followed by '_', an upper-case letter or
+// nothing at all.
+func testFuncName(ident string, maps Maps) (string, bool) {
+	local := ""
+	for prefix := range maps.TestPrefixes {
+		if len(prefix) > len(local) && strings.HasPrefix(ident, prefix) {
+			rest := ident[len(prefix):]
+			if r, _ := utf8.DecodeRuneInString(rest); rest == "" || r == '_' || unicode.IsUpper(r) {
+				local = prefix
+			}
+		}
+	}
+	if local == "" {
+		return "", false
+	}
+	goPrefix := maps.TestPrefixes[local]
+	name := goPrefix + ident[len(local):]
+	if rest := strings.TrimPrefix(ident[len(local):], "_"); maps.Transliterator != nil && !isASCII([]byte(rest)) {
+		latin := maps.Transliterator.Name(rest)
+		if goPrefix == "Example" {
+			latin = strings.ToLower(latin)
+		}
+		return goPrefix + "_" + latin, true
+	}
+	if !isValidGoIdent(name) {
+		// go vet wants Example_suffix names to continue in lower case.
+		mangled := mangleIdent(ident)
+		if goPrefix == "Example" {
+			mangled = strings.ToLower(mangled)
+		}
+		name = goPrefix + "_" + mangled
+	}
+	return name, true
+}
+
+// testFileInfo is what a localized-to-Go pass needs to know about a test file
+// as a whole.
+type testFileInfo struct {
+	// methods maps the offsets of localized testing method names in the body
+	// to their Go names. Only selectors on a parameter of type *testing.T,
+	// *testing.B, *testing.F or testing.TB count, as in t.ত্রুটি_লেখো(...).
+	methods map[int]string
+	// funcs maps the offsets of the names of top-level functions with a
+	// localized test prefix, and of references to them, to the names the go
+	// tool recognizes.
+	funcs map[int]string
+}
+
+// analyzeTestFile finds the test functions and testing method selectors of a
+// test file body.
+func analyzeTestFile(body []byte, maps Maps) *testFileInfo {
+	tf := &testFileInfo{methods: make(map[int]string), funcs: make(map[int]string)}
+	toks := scanKeywordTokens(body)
+	is := func(t keywordToken, keyword string) bool {
+		return t.kind == kwIdent && (t.text == keyword || maps.LocalToGo[t.text] == keyword)
+	}
+
+	// Only functions declared at the top level without a receiver are
+	// tests; types, variables and methods keep their names.
+	tests := make(map[string]string)
+	depth := 0
+	for i, t := range toks {
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		}
+		if depth != 0 || !is(t, "func") || i+1 == len(toks) || toks[i+1].kind != kwIdent {
+			continue
+		}
+		if name, ok := testFuncName(toks[i+1].text, maps); ok {
+			tests[toks[i+1].text] = name
+		}
+	}
+	for i, t := range toks {
+		if name, ok := tests[t.text]; ok && t.kind == kwIdent && (i == 0 || toks[i-1].text != "." && toks[i-1].text != "@") {
+			tf.funcs[t.off] = name
+		}
+	}
+
+	if len(maps.TestMethods) == 0 {
+		return tf
+	}
+	pkg := testingPackageName(toks, is)
+
+	// A scope is a function body with the parameters declared for it; the
+	// value tells whether the parameter has a testing type.
+	type scope struct {
+		start, end int
+		params     map[string]bool
+	}
+	var scopes []scope
+	for i, t := range toks {
+		if !is(t, "func") {
+			continue
+		}
+		j := i + 1
+		var groups [][]keywordToken
+		if j < len(toks) && toks[j].text == "(" {
+			// A receiver or the parameters of a function literal.
+			end := matchingToken(toks, j)
+			groups = append(groups, toks[j+1:end])
+			j = end + 1
+		}
+		if j < len(toks) && toks[j].kind == kwIdent && j+1 < len(toks) && (toks[j+1].text == "(" || toks[j+1].text == "[") {
+			j++
+			if toks[j].text == "[" {
+				j = matchingToken(toks, j) + 1
+			}
+			if j < len(toks) && toks[j].text == "(" {
+				end := matchingToken(toks, j)
+				groups = append(groups, toks[j+1:end])
+				j = end + 1
+			}
+		}
+		if len(groups) == 0 {
+			continue
+		}
+		open := functionBody(toks, j, is)
+		if open < 0 {
+			continue
+		}
+		sc := scope{start: toks[open].off, end: len(body), params: make(map[string]bool)}
+		if end := matchingToken(toks, open); end < len(toks) {
+			sc.end = toks[end].off
+		}
+		for _, g := range groups {
+			for name, typed := range testingParams(g, pkg) {
+				sc.params[name] = typed
+			}
+		}
+		scopes = append(scopes, sc)
+	}
+
+	for i := 0; i+2 < len(toks); i++ {
+		recv, dot, sel := toks[i], toks[i+1], toks[i+2]
+		if recv.kind != kwIdent || dot.text != "." || sel.kind != kwIdent {
+			continue
+		}
+		mapped, ok := maps.TestMethods[sel.text]
+		if !ok || i > 0 && toks[i-1].text == "." {
+			continue
+		}
+		// The innermost function declaring the name decides.
+		for k := len(scopes) - 1; k >= 0; k-- {
+			sc := scopes[k]
+			if recv.off <= sc.start || recv.off >= sc.end {
+				continue
+			}
+			if typed, ok := sc.params[recv.text]; ok {
+				if typed {
+					tf.methods[sel.off] = mapped
+				}
+				break
+			}
+		}
+	}
+	return tf
+}
+
+// testingPackageName returns the name the file imports "testing" under, or
+// "" for a dot import.
+func testingPackageName(toks []keywordToken, is func(keywordToken, string) bool) string {
+	for i, t := range toks {
+		if t.kind != kwLiteral || t.text != `"testing"` && t.text != "`testing`" || i == 0 {
+			continue
+		}
+		prev := toks[i-1]
+		if prev.text == "." {
+			return ""
+		}
+		if prev.kind == kwIdent && prev.text != "_" && !is(prev, "import") && i >= 2 {
+			if before := toks[i-2]; before.text == "(" || before.text == ";" || before.kind == kwNewline || is(before, "import") {
+				return prev.text
+			}
+		}
+		break
+	}
+	return "testing"
+}
+
+// matchingToken returns the index of the bracket closing the one at open, or
+// len(toks) if it is not closed.
+func matchingToken(toks []keywordToken, open int) int {
+	depth := 0
+	for i := open; i < len(toks); i++ {
+		switch toks[i].text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(toks)
+}
+
+// functionBody returns the index of the "{" opening the body of a function
+// whose results start at toks[from], or -1 for a function type.
+func functionBody(toks []keywordToken, from int, is func(keywordToken, string) bool) int {
+	for i := from; i < len(toks); i++ {
+		switch t := toks[i]; {
+		case t.text == "{":
+			if i > 0 && (is(toks[i-1], "struct") || is(toks[i-1], "interface")) {
+				i = matchingToken(toks, i)
+				continue
+			}
+			return i
+		case t.text == "(" || t.text == "[":
+			i = matchingToken(toks, i)
+		case t.kind == kwNewline || t.text == ";" || t.text == "," || t.text == ")" || t.text == "]" || t.text == "}" || t.text == "=":
+			return -1
+		}
+	}
+	return -1
+}
+
+// testingParams returns the names declared in a parameter list and whether
+// each has one of the testing types.
+func testingParams(list []keywordToken, pkg string) map[string]bool {
+	params := make(map[string]bool)
+	var segments [][]keywordToken
+	depth, last := 0, 0
+	for i, t := range list {
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ",":
+			if depth == 0 {
+				segments = append(segments, list[last:i])
+				last = i + 1
+			}
+		}
+	}
+	segments = append(segments, list[last:])
+
+	// In "a, b *testing.T" the names before the last one share its type.
+	var pending []string
+	for _, seg := range segments {
+		if len(seg) > 0 && seg[0].text == "@" {
+			seg = seg[1:]
+		}
+		if len(seg) == 0 || seg[0].kind != kwIdent {
+			pending = nil
+			continue
+		}
+		if len(seg) == 1 {
+			pending = append(pending, seg[0].text)
+			continue
+		}
+		if seg[1].text == "." {
+			// An unnamed parameter of a qualified type.
+			pending = nil
+			continue
+		}
+		typed := isTestingType(seg[1:], pkg)
+		for _, name := range append(pending, seg[0].text) {
+			params[name] = typed
+		}
+		pending = nil
+	}
+	return params
+}
+
+// isTestingType reports whether typ spells *testing.T, *testing.B,
+// *testing.F or testing.TB, with the package named pkg.
+func isTestingType(typ []keywordToken, pkg string) bool {
+	var b strings.Builder
+	for _, t := range typ {
+		b.WriteString(t.text)
+	}
+	qual := ""
+	if pkg != "" {
+		qual = pkg + "."
+	}
+	switch b.String() {
+	case "*" + qual + "T", "*" + qual + "B", "*" + qual + "F", qual + "TB":
+		return true
+	}
+	return false
+}
+
+// GeneratedNames returns the identifiers of src that TranspileFileLocalizedToGo
+// renames to something other than a keyword or predeclared identifier
+// (mangled names and localized test prefixes), keyed by their Go spelling.
+// Transliterated names are readable as they are and left out.
+func GeneratedNames(srcPath string, src []byte, maps Maps) map[string]string {
+	names := make(map[string]string)
+	escapedNames := make(map[string]struct{})
+	body := src[buildTagPrefixLen(src):]
+	var tests *testFileInfo
+	if isTestFile(srcPath, maps) {
+		tests = analyzeTestFile(body, maps)
+	}
+	scanIdents(body, func(start, end int, escaped bool) {
+		ident := string(body[start:end])
+		if escaped {
+			escapedNames[ident] = struct{}{}
+		}
+		var generated string
+		if tests != nil {
+			if _, ok := tests.methods[start]; ok {
+				return
+			}
+			if _, ok := escapedNames[ident]; !ok {
+				generated = tests.funcs[start]
+			}
+		}
+		if generated == "" {
+			generated = translateIdentLocalizedToGo(ident, maps, escaped, escapedNames)
+		}
+		if generated == ident || generated == maps.LocalToGo[ident] || generated == maps.LocalPredeclared[ident] {
+			return
+		}
+		if maps.Transliterator != nil {
+			if original, ok := maps.Transliterator.Original(generated); ok && original == ident {
+				return
+			}
+		}
+		names[generated] = ident
+	})
+	return names
+}
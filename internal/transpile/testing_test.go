@@ -0,0 +1,134 @@
+package transpile
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalizedTestFile(t *testing.T) {
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := []byte("প্যাকেজ calc\n\nফাংশন পরীক্ষা_যোগফল(t *testing.T) {\n\tt.ত্রুটি_লেখো(\"x\")\n}\n\nফাংশন পরীক্ষার্থী() {}\n")
+
+	got, err := TranspileFileLocalizedToGo("calc_test.p.go", src, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testName := "Test_" + mangleIdent("পরীক্ষা_যোগফল")
+	for _, want := range []string{"func " + testName + "(", "t.Errorf(", "func " + mangleIdent("পরীক্ষার্থী") + "()"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+
+	names := GeneratedNames("calc_test.p.go", src, maps)
+	if names[testName] != "পরীক্ষা_যোগফল" {
+		t.Errorf("GeneratedNames[%s] = %q", testName, names[testName])
+	}
+	if len(names) != 2 {
+		t.Errorf("GeneratedNames = %v, want 2 entries", names)
+	}
+
+	// Outside test files the prefix and method aliases are left alone.
+	got, err = TranspileFileLocalizedToGo("calc.p.go", src, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "Test_") || strings.Contains(string(got), "Errorf") {
+		t.Errorf("testing idioms applied to non-test file:\n%s", got)
+	}
+}
+
+func TestLocalizedTestPrefixes(t *testing.T) {
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "bn.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"পরীক্ষা":          "Test",
+		"পরীক্ষা_যোগফল":    "Test_" + mangleIdent("পরীক্ষা_যোগফল"),
+		"বেঞ্চমার্ক_যোগফল": "Benchmark_" + mangleIdent("বেঞ্চমার্ক_যোগফল"),
+		"ফাজ_পার্স":        "Fuzz_" + mangleIdent("ফাজ_পার্স"),
+		"উদাহরণ_যোগফল":     "Example_" + strings.ToLower(mangleIdent("উদাহরণ_যোগফল")),
+		"পরীক্ষা_Sum":      "Test_Sum",
+		"পরীক্ষাSum":       "TestSum",
+	}
+	for in, want := range cases {
+		got, ok := testFuncName(in, maps)
+		if !ok || got != want {
+			t.Errorf("testFuncName(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"পরীক্ষার্থী", "পরীক্ষাsum", "উদাহরণমূলক"} {
+		if got, ok := testFuncName(in, maps); ok {
+			t.Errorf("testFuncName(%q) = %q, want no rewrite", in, got)
+		}
+	}
+}
+
+func TestTestingMethodReceivers(t *testing.T) {
+	defer func(size int) { streamChunkSize = size }(streamChunkSize)
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "es.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src, want string
+	}{
+		// Only selectors on a testing parameter are method aliases.
+		{
+			"paquete p\n\nimportar \"testing\"\n\nfuncion f(t *testing.T, registro Registro) {\n\tregistro.Registrar(\"x\")\n\tt.Registrar(\"x\")\n}\n",
+			"package p\n\nimport \"testing\"\n\nfunc f(t *testing.T, registro Registro) {\n\tregistro.Registrar(\"x\")\n\tt.Log(\"x\")\n}\n",
+		},
+		// Closures see the parameters of the enclosing function unless they
+		// declare their own.
+		{
+			"paquete p\n\nimportar pr \"testing\"\n\nfuncion f(a, b pr.TB) {\n\ta.Ejecutar(\"s\", funcion(t *pr.T) { b.Omitir() })\n\tg := funcion(a Registro) { a.Omitir() }\n}\n",
+			"package p\n\nimport pr \"testing\"\n\nfunc f(a, b pr.TB) {\n\ta.Run(\"s\", func(t *pr.T) { b.Skip() })\n\tg := func(a Registro) { a.Omitir() }\n}\n",
+		},
+		{
+			"paquete p\n\nfuncion (s *Suite) f(x *testing.B) {\n\ts.Abortar()\n\tx.Abortar()\n}\n",
+			"package p\n\nfunc (s *Suite) f(x *testing.B) {\n\ts.Abortar()\n\tx.Fatal()\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := TranspileFileLocalizedToGo("p_test.p.go", []byte(tt.src), maps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%q:\n%s\nwant:\n%s", tt.src, got, tt.want)
+		}
+		for _, size := range []int{1, 64 << 10} {
+			streamChunkSize = size
+			checkStream(t, "p_test.p.go", []byte(tt.src), []byte(tt.want), maps, LocalToGo)
+		}
+	}
+}
+
+func TestTestFuncNamesOnlyForFunctions(t *testing.T) {
+	maps, err := LoadKeywordMapData(mustRead(filepath.Join("..", "..", "lang", "es.json")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Types, variables, methods and selectors keep a test prefix; only the
+	// top-level function and references to it are renamed.
+	src := "paquete p\n\ntipo PruebaDatos estructura{}\n\nvar PruebaValor = 1\n\nfuncion PruebaSuma(t *testing.T) {\n\t_ = PruebaDatos{}\n\t_ = otro.PruebaSuma\n}\n\nfuncion (d PruebaDatos) PruebaMetodo() {}\n\nvar f = PruebaSuma\n"
+	want := "package p\n\ntype PruebaDatos struct{}\n\nvar PruebaValor = 1\n\nfunc TestSuma(t *testing.T) {\n\t_ = PruebaDatos{}\n\t_ = otro.PruebaSuma\n}\n\nfunc (d PruebaDatos) PruebaMetodo() {}\n\nvar f = TestSuma\n"
+	got, err := TranspileFileLocalizedToGo("p_test.p.go", []byte(src), maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	checkStream(t, "p_test.p.go", []byte(src), []byte(want), maps, LocalToGo)
+
+	names := GeneratedNames("p_test.p.go", []byte(src), maps)
+	if len(names) != 1 || names["TestSuma"] != "PruebaSuma" {
+		t.Errorf("GeneratedNames = %v, want only TestSuma", names)
+	}
+}
@@ -0,0 +1,322 @@
+package transpile
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// translitRule is one rule of the transliteration table of a keyword map,
+// "src > dst ;" or "src } context > dst ;" in the syntax of ICU transforms.
+// The context must follow src but is not consumed.
+type translitRule struct {
+	src, dst string
+	// context is a literal, or a character class when class is set.
+	context string
+	class   map[rune]bool
+}
+
+// parseTranslitRules parses the transliteration section of a keyword map.
+// Besides rules it accepts "$name = [chars] ;" class definitions, usable as
+// contexts, and "#" comment lines.
+func parseTranslitRules(lines []string) ([]translitRule, error) {
+	classes := make(map[string]map[rune]bool)
+	parseClass := func(s string) (map[rune]bool, bool) {
+		if strings.HasPrefix(s, "$") {
+			class, ok := classes[s[1:]]
+			return class, ok
+		}
+		if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+			return nil, false
+		}
+		class := make(map[rune]bool)
+		for _, r := range s[1 : len(s)-1] {
+			class[r] = true
+		}
+		return class, true
+	}
+
+	var rules []translitRule
+	for i, line := range lines {
+		line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), ";"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, def, ok := strings.Cut(line, "="); ok && strings.HasPrefix(line, "$") {
+			name, def = strings.TrimSpace(name[1:]), strings.TrimSpace(def)
+			class, ok := parseClass(def)
+			if name == "" || !ok {
+				return nil, fmt.Errorf("transliteration rule %d: bad class definition %q", i+1, line)
+			}
+			classes[name] = class
+			continue
+		}
+		lhs, dst, ok := strings.Cut(line, ">")
+		if !ok {
+			return nil, fmt.Errorf("transliteration rule %d: missing '>' in %q", i+1, line)
+		}
+		rule := translitRule{dst: strings.TrimSpace(dst)}
+		src, context, hasContext := strings.Cut(lhs, "}")
+		rule.src = strings.TrimSpace(src)
+		if hasContext {
+			context = strings.TrimSpace(context)
+			if class, ok := parseClass(context); ok {
+				rule.class = class
+			} else if strings.HasPrefix(context, "$") || context == "" {
+				return nil, fmt.Errorf("transliteration rule %d: unknown context %q", i+1, context)
+			} else {
+				rule.context = context
+			}
+		}
+		if rule.src == "" {
+			return nil, fmt.Errorf("transliteration rule %d: empty source in %q", i+1, line)
+		}
+		for _, r := range rule.dst {
+			if r >= utf8.RuneSelf || !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return nil, fmt.Errorf("transliteration rule %d: %q must map to ASCII letters, digits or '_'", i+1, rule.src)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// transliterate applies rules to s: at every position the first rule that
+// matches wins. ASCII letters, digits and '_' without a rule are kept, other
+// characters become uXXXX.
+func transliterate(rules []translitRule, s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for _, rule := range rules {
+			if !strings.HasPrefix(s[i:], rule.src) {
+				continue
+			}
+			rest := s[i+len(rule.src):]
+			switch {
+			case rule.class != nil:
+				r, size := utf8.DecodeRuneInString(rest)
+				if size == 0 || !rule.class[r] {
+					continue
+				}
+			case rule.context != "":
+				if !strings.HasPrefix(rest, rule.context) {
+					continue
+				}
+			}
+			b.WriteString(rule.dst)
+			i += len(rule.src)
+			matched = true
+			break
+		}
+		if matched {
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r < utf8.RuneSelf && (r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		} else {
+			fmt.Fprintf(&b, "u%04X", r)
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// Transliterator gives the non-ASCII identifiers of localized sources
+// readable Latin names, using the transliteration table of a keyword map.
+// It remembers every name it hands out, so the names stay unique and can be
+// mapped back: a name that is taken gets a _2, _3, ... suffix.
+type Transliterator struct {
+	rules []translitRule
+	// names maps original identifiers to their Latin names, and latin the
+	// other way round.
+	names, latin map[string]string
+	reserved     map[string]struct{}
+	// adopted holds the original identifiers whose names were taken over
+	// from other Transliterators (see Adopt).
+	adopted map[string]struct{}
+	// given holds the names handed out since NewTransliterator.
+	given   map[string]struct{}
+	changed bool
+}
+
+// NewTransliterator returns a Transliterator for the rules of maps that
+// starts from names, a mapping saved by an earlier run (see Names).
+func NewTransliterator(maps Maps, names map[string]string) (*Transliterator, error) {
+	if len(maps.translit) == 0 {
+		return nil, fmt.Errorf("the keyword map has no transliteration table")
+	}
+	t := &Transliterator{
+		rules:    maps.translit,
+		names:    make(map[string]string, len(names)),
+		latin:    make(map[string]string, len(names)),
+		reserved: make(map[string]struct{}),
+		adopted:  make(map[string]struct{}),
+		given:    make(map[string]struct{}),
+	}
+	for original, latin := range names {
+		if !token.IsIdentifier(latin) || isASCII([]byte(original)) {
+			return nil, fmt.Errorf("bad transliteration %q → %q", original, latin)
+		}
+		if other, ok := t.latin[latin]; ok {
+			return nil, fmt.Errorf("%q and %q are both transliterated to %q", other, original, latin)
+		}
+		t.names[original] = latin
+		t.latin[latin] = original
+	}
+	return t, nil
+}
+
+// Reserve keeps name from being handed out, because an ASCII identifier of
+// the sources already uses it. A saved name that collides is given up, unless
+// it was already handed out again: then the name is used by other sources
+// than the reserving ones, which must not change under them.
+func (t *Transliterator) Reserve(name string) {
+	t.reserved[name] = struct{}{}
+	if _, ok := t.given[name]; ok {
+		return
+	}
+	if original, ok := t.latin[name]; ok {
+		if _, ok := t.adopted[original]; ok {
+			// The name belongs to another package.
+			return
+		}
+		delete(t.latin, name)
+		delete(t.names, original)
+		t.changed = true
+	}
+}
+
+// Names returns the mapping from original identifiers to Latin names, to be
+// saved for the next run. Adopted names are left out.
+func (t *Transliterator) Names() map[string]string {
+	names := make(map[string]string, len(t.names))
+	for original, latin := range t.names {
+		if _, ok := t.adopted[original]; !ok {
+			names[original] = latin
+		}
+	}
+	return names
+}
+
+// Adopted returns the names taken over by Adopt.
+func (t *Transliterator) Adopted() map[string]string {
+	names := make(map[string]string, len(t.adopted))
+	for original := range t.adopted {
+		names[original] = t.names[original]
+	}
+	return names
+}
+
+// Changed reports whether names were added or given up since
+// NewTransliterator.
+func (t *Transliterator) Changed() bool {
+	return t.changed
+}
+
+// Adopt takes over names given by another Transliterator, such as the
+// exported names of a dependency, which the sources must spell the same way
+// to refer to them. Names of t that conflict are given up, and adopted names
+// are never given up for Reserve. Adopt reports whether a name handed out
+// since NewTransliterator changed: output using it is then stale.
+func (t *Transliterator) Adopt(names map[string]string) bool {
+	stale := false
+	for original, latin := range names {
+		if !token.IsIdentifier(latin) || isASCII([]byte(original)) {
+			continue
+		}
+		old, ok := t.names[original]
+		if ok && old == latin {
+			if _, ok := t.adopted[original]; !ok {
+				t.adopted[original] = struct{}{}
+				t.changed = true
+			}
+			continue
+		}
+		if ok {
+			delete(t.latin, old)
+			if _, ok := t.given[old]; ok {
+				stale = true
+			}
+		}
+		if other, ok := t.latin[latin]; ok {
+			delete(t.names, other)
+			if _, ok := t.given[latin]; ok {
+				stale = true
+			}
+		}
+		t.names[original] = latin
+		t.latin[latin] = original
+		t.adopted[original] = struct{}{}
+		t.changed = true
+	}
+	return stale
+}
+
+// Original returns the identifier the Latin name was given to.
+func (t *Transliterator) Original(latin string) (string, bool) {
+	original, ok := t.latin[latin]
+	return original, ok
+}
+
+// Name returns the Latin name of a non-ASCII identifier. The name is
+// exported when ident would be: when it starts with an upper-case letter, or
+// when it is no valid Go identifier, as mangled names are.
+func (t *Transliterator) Name(ident string) string {
+	if latin, ok := t.names[ident]; ok {
+		t.given[latin] = struct{}{}
+		return latin
+	}
+	base := transliterate(t.rules, ident)
+	first, _ := utf8.DecodeRuneInString(ident)
+	exported := !isValidGoIdent(ident) || unicode.IsUpper(first)
+	if base == "" || !isASCIILetter(base[0]) {
+		base = "X" + base
+	}
+	if exported {
+		base = strings.ToUpper(base[:1]) + base[1:]
+	} else {
+		base = strings.ToLower(base[:1]) + base[1:]
+	}
+	latin := base
+	for n := 2; !t.available(latin); n++ {
+		latin = base + "_" + strconv.Itoa(n)
+	}
+	t.names[ident] = latin
+	t.latin[latin] = ident
+	t.given[latin] = struct{}{}
+	t.changed = true
+	return latin
+}
+
+// ASCIIIdents returns the ASCII identifiers of src outside comments and
+// literals, for Transliterator.Reserve.
+func ASCIIIdents(src []byte) []string {
+	var idents []string
+	for _, t := range scanKeywordTokens(src) {
+		if t.kind == kwIdent && isASCII([]byte(t.text)) {
+			idents = append(idents, t.text)
+		}
+	}
+	return idents
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (t *Transliterator) available(name string) bool {
+	if _, ok := t.latin[name]; ok {
+		return false
+	}
+	if _, ok := t.reserved[name]; ok {
+		return false
+	}
+	// Predeclared names would be shadowed, and Bgo_ is the mangling prefix.
+	return !token.IsKeyword(name) && types.Universe.Lookup(name) == nil && !strings.HasPrefix(name, "Bgo_")
+}
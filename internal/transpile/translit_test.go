@@ -0,0 +1,176 @@
+package transpile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTransliterationRules(t *testing.T) {
+	rules, err := parseTranslitRules([]string{
+		"# vowels after a consonant replace its inherent a",
+		"$sign = [ি] ;",
+		"ক } $sign > k ;",
+		"ক } া > k ;",
+		"ক > ka ;",
+		"া > a ;",
+		"ি > i ;",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{"ক": "ka", "কা": "ka", "কি": "ki", "ককি": "kaki", "ক_x1": "ka_x1", "কé": "kau00E9"} {
+		if got := transliterate(rules, in); got != want {
+			t.Errorf("transliterate(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	for _, bad := range [][]string{{"ক"}, {"ক > é"}, {"ক } $none > k"}, {" > k"}, {"$x = ক"}} {
+		if _, err := parseTranslitRules(bad); err == nil {
+			t.Errorf("parseTranslitRules(%q) accepted", bad)
+		}
+	}
+}
+
+func TestTransliterator(t *testing.T) {
+	data, _ := EmbeddedKeywordMap("bn")
+	maps, err := LoadKeywordMapData(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTransliterator(Maps{}, nil); err == nil {
+		t.Error("NewTransliterator accepted a map without rules")
+	}
+	tr, err := NewTransliterator(maps, map[string]string{"পুরনো": "puro", "মোট": "total"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved names are kept, unless an ASCII identifier takes them.
+	if got := tr.Name("মোট"); got != "total" {
+		t.Errorf("saved name = %q, want total", got)
+	}
+	tr.Reserve("puro")
+	tr.Reserve("Kaj")
+	if _, ok := tr.Names()["পুরনো"]; ok {
+		t.Error("reserved name was not given up")
+	}
+	// A name handed out in this run stays.
+	tr.Reserve("total")
+	if _, ok := tr.Original("total"); !ok {
+		t.Error("name in use was given up")
+	}
+
+	kaj := tr.Name("কাজ")
+	if kaj != "Kaj_2" {
+		t.Errorf("Name(কাজ) = %q, want Kaj_2", kaj)
+	}
+	if again := tr.Name("কাজ"); again != kaj {
+		t.Errorf("second Name(কাজ) = %q, want %q", again, kaj)
+	}
+	if original, ok := tr.Original(kaj); !ok || original != "কাজ" {
+		t.Errorf("Original(%q) = %q, %v", kaj, original, ok)
+	}
+	// Identifiers with vowel signs are not valid Go and, like their mangled
+	// names, exported.
+	if got := tr.Name("বাংলা"); got != "Bangla" {
+		t.Errorf("Name(বাংলা) = %q, want Bangla", got)
+	}
+	if !tr.Changed() {
+		t.Error("Changed() = false")
+	}
+
+	seen := make(map[string]string)
+	for original, latin := range tr.Names() {
+		if other, ok := seen[latin]; ok {
+			t.Errorf("%q and %q share %q", other, original, latin)
+		}
+		seen[latin] = original
+	}
+
+	if _, err := NewTransliterator(maps, map[string]string{"ক": "x", "খ": "x"}); err == nil {
+		t.Error("NewTransliterator accepted a name given twice")
+	}
+
+	// Names never shadow keywords or predeclared identifiers.
+	small, err := LoadKeywordMapData([]byte(`{"transliteration": ["ক > len ;", "খ > for ;"]}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err = NewTransliterator(small, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.Name("ক"); got != "len_2" {
+		t.Errorf("Name(ক) = %q, want len_2", got)
+	}
+	if got := tr.Name("খ"); got != "for_2" {
+		t.Errorf("Name(খ) = %q, want for_2", got)
+	}
+}
+
+func TestTransliteratedTranspile(t *testing.T) {
+	data, _ := EmbeddedKeywordMap("bn")
+	maps, err := LoadKeywordMapData(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maps.Transliterator, err = NewTransliterator(maps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := "প্যাকেজ main\n\nফাংশন যোগফল(ক, খ পূর্ণসংখ্যা) পূর্ণসংখ্যা {\n\tফেরত ক + খ\n}\n"
+	out, err := TranspileFileLocalizedToGo("x.p.go", []byte(src), maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "Bgo_") || !isASCII(out) {
+		t.Errorf("names were not transliterated:\n%s", out)
+	}
+	back, err := TranspileFileGoToLocal("x.go", out, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back) != src {
+		t.Errorf("round trip changed the source:\n%s", back)
+	}
+}
+
+func TestTransliteratorAdopt(t *testing.T) {
+	data, _ := EmbeddedKeywordMap("bn")
+	maps, err := LoadKeywordMapData(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTransliterator(maps, map[string]string{"পুরনো": "Puro"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Reserve("Jogafal")
+	if got := tr.Name("যোগফল"); got != "Jogafal_2" {
+		t.Fatalf("Name(যোগফল) = %q, want Jogafal_2", got)
+	}
+
+	// The name in use changes, and the conflicting saved one is given up.
+	if !tr.Adopt(map[string]string{"যোগফল": "Jogafal", "নতুন": "Puro"}) {
+		t.Error("Adopt did not report the changed name")
+	}
+	if got := tr.Name("যোগফল"); got != "Jogafal" {
+		t.Errorf("Name(যোগফল) = %q after Adopt", got)
+	}
+	if got := tr.Name("পুরনো"); got == "Puro" {
+		t.Errorf("Name(পুরনো) kept the adopted name")
+	}
+	if tr.Adopt(map[string]string{"যোগফল": "Jogafal"}) {
+		t.Error("adopting the same name again reported a change")
+	}
+
+	// Adopted names stay out of Names and survive Reserve.
+	tr.Reserve("Puro")
+	if got := tr.Adopted(); !reflect.DeepEqual(got, map[string]string{"যোগফল": "Jogafal", "নতুন": "Puro"}) {
+		t.Errorf("Adopted = %v", got)
+	}
+	if _, ok := tr.Names()["যোগফল"]; ok {
+		t.Errorf("Names = %v, includes an adopted name", tr.Names())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"go/token"
 	"os"
 	"strings"
 	"unicode"
@@ -15,6 +16,16 @@ import (
 type KeywordMap struct {
 	Keywords    map[string]string `json:"keywords"`
 	Predeclared map[string]string `json:"predeclared"`
+	BuildTags   map[string]string `json:"build_tags"`
+	Testing     TestingMap        `json:"testing"`
+	Directives  map[string]string `json:"directives"`
+	StructTags  map[string]string `json:"struct_tags"`
+	// Transliteration holds the rules Transliterator uses, see
+	// parseTranslitRules.
+	Transliteration []string `json:"transliteration"`
+	// Digits spells the digits 0 to 9 in the local script, for
+	// Maps.LocalizeDigits.
+	Digits string `json:"digits"`
 }
 
 type Maps struct {
@@ -23,7 +34,30 @@ type Maps struct {
 	GoToLocal        map[string]string
 	GoPredeclared    map[string]string
 	LocalAll         map[string]struct{}
-	AllowGoKeywords  bool
+	// Identity holds the entries spelled the same in both languages, such
+	// as var and error in es.json. They are valid in either direction and
+	// say nothing about the language of a file.
+	Identity        map[string]struct{}
+	LocalBuildTags  map[string]string
+	TestPrefixes    map[string]string
+	TestMethods     map[string]string
+	LocalDirectives map[string]string
+	LocalStructTags map[string]string
+	AllowGoKeywords bool
+	// Transliteration holds the rules of the map's transliteration table,
+	// used by NewTransliterator.
+	Transliteration []string
+	// Transliterator, when set, gives non-ASCII identifiers Latin names
+	// instead of mangled ones.
+	Transliterator *Transliterator
+	translit       []translitRule
+	// Digits holds the map's local digits, 0 to 9, if it has any. Number
+	// literals with digits of any script become ASCII going to Go;
+	// LocalizeDigits makes Go-to-local output use Digits in decimal
+	// literals.
+	Digits         string
+	LocalizeDigits bool
+	digits         []rune
 }
 
 func LoadKeywordMap(path string) (Maps, error) {
@@ -45,37 +79,110 @@ func LoadKeywordMapData(data []byte, allowGoKeywords bool) (Maps, error) {
 		GoToLocal:        make(map[string]string),
 		GoPredeclared:    make(map[string]string),
 		LocalAll:         make(map[string]struct{}),
+		Identity:         make(map[string]struct{}),
+		LocalBuildTags:   make(map[string]string),
+		TestPrefixes:     make(map[string]string),
+		TestMethods:      make(map[string]string),
+		LocalDirectives:  make(map[string]string),
+		LocalStructTags:  make(map[string]string),
 		AllowGoKeywords:  allowGoKeywords,
 	}
+	if err := validateKeywordMap(km); err != nil {
+		return Maps{}, err
+	}
+	rules, err := parseTranslitRules(km.Transliteration)
+	if err != nil {
+		return Maps{}, err
+	}
+	maps.Transliteration = km.Transliteration
+	maps.translit = rules
+	digits, err := parseDigits(km.Digits)
+	if err != nil {
+		return Maps{}, err
+	}
+	maps.Digits = km.Digits
+	maps.digits = digits
 	for k, v := range km.Keywords {
 		maps.LocalToGo[k] = v
-		maps.GoToLocal[v] = k
+		maps.GoToLocal[v] = preferredLocal(maps.GoToLocal[v], k, v)
 		maps.LocalAll[k] = struct{}{}
+		if k == v {
+			maps.Identity[k] = struct{}{}
+		}
 	}
 	for k, v := range km.Predeclared {
 		maps.LocalPredeclared[k] = v
-		maps.GoPredeclared[v] = k
+		maps.GoPredeclared[v] = preferredLocal(maps.GoPredeclared[v], k, v)
 		maps.LocalAll[k] = struct{}{}
+		if k == v {
+			maps.Identity[k] = struct{}{}
+		}
+	}
+	for k, v := range km.BuildTags {
+		maps.LocalBuildTags[k] = v
+	}
+	for k, v := range km.Testing.Prefixes {
+		maps.TestPrefixes[k] = v
+	}
+	for k, v := range km.Testing.Methods {
+		maps.TestMethods[k] = v
+	}
+	for k, v := range km.Directives {
+		maps.LocalDirectives[k] = v
+	}
+	for k, v := range km.StructTags {
+		maps.LocalStructTags[k] = v
 	}
 	return maps, nil
 }
 
-// ContainsLocalizedKeywords reports whether src includes any localized keyword/predeclared identifiers.
-// It ignores strings/comments and respects the same identifier rules as the transpiler.
-func ContainsLocalizedKeywords(src []byte, maps Maps) bool {
-	found := false
-	scanIdentifiers(src, func(ident string) {
-		if _, ok := maps.GoToLocal[ident]; ok {
-			return
+// preferredLocal picks the spelling Go-to-local output uses when several
+// local words map to the Go word goWord: a localized one over the identity
+// entry, then the smallest, so the choice does not depend on map order.
+func preferredLocal(current, candidate, goWord string) string {
+	switch {
+	case current == "":
+		return candidate
+	case (current == goWord) != (candidate == goWord):
+		if current == goWord {
+			return candidate
+		}
+		return current
+	case candidate < current:
+		return candidate
+	}
+	return current
+}
+
+// validateKeywordMap rejects maps whose words would be ambiguous: keyword
+// entries must name Go keywords, a word cannot be both a keyword and a
+// predeclared name, and a local word spelled like a Go keyword or mapped
+// predeclared name must map to itself.
+func validateKeywordMap(km KeywordMap) error {
+	goWords := make(map[string]struct{})
+	for local, goWord := range km.Keywords {
+		if !token.IsKeyword(goWord) {
+			return fmt.Errorf("keyword %q maps to %q, which is not a Go keyword", local, goWord)
 		}
-		if _, ok := maps.GoPredeclared[ident]; ok {
-			return
+		if _, ok := km.Predeclared[local]; ok {
+			return fmt.Errorf("%q is both a keyword and a predeclared name", local)
 		}
-		if _, ok := maps.LocalAll[ident]; ok {
-			found = true
+		goWords[goWord] = struct{}{}
+	}
+	for local, goWord := range km.Predeclared {
+		if !token.IsIdentifier(goWord) {
+			return fmt.Errorf("predeclared %q maps to %q, which is not a Go identifier", local, goWord)
 		}
-	})
-	return found
+		goWords[goWord] = struct{}{}
+	}
+	for _, section := range []map[string]string{km.Keywords, km.Predeclared} {
+		for local, goWord := range section {
+			if _, ok := goWords[local]; (ok || token.IsKeyword(local)) && local != goWord {
+				return fmt.Errorf("%q is the Go name of another entry but maps to %q", local, goWord)
+			}
+		}
+	}
+	return nil
 }
 
 type Direction int
@@ -83,25 +190,41 @@ type Direction int
 const (
 	LocalToGo Direction = iota
 	GoToLocal
+	// AutoDirection makes TranspileFile detect the direction with
+	// DetectDirection.
+	AutoDirection
 )
 
-func TranspileFile(srcPath string, src []byte, maps Maps) ([]byte, error) {
+// TranspileFile transpiles src in the given direction, or in the detected one
+// for AutoDirection, exactly as TranspileFileLocalizedToGo and
+// TranspileFileGoToLocal do.
+func TranspileFile(srcPath string, src []byte, maps Maps, direction Direction) ([]byte, error) {
+	if direction == AutoDirection {
+		d, err := DetectDirection(src, maps)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", srcPath, err)
+		}
+		direction = d.Direction
+	}
+	switch direction {
+	case LocalToGo:
+		return TranspileFileLocalizedToGo(srcPath, src, maps)
+	case GoToLocal:
+		return TranspileFileGoToLocal(srcPath, src, maps)
+	}
+	return nil, fmt.Errorf("%s: unknown direction %d", srcPath, direction)
+}
+
+func TranspileFileGoToLocal(srcPath string, src []byte, maps Maps) ([]byte, error) {
 	prefixLen := buildTagPrefixLen(src)
 	prefix := src[:prefixLen]
 	body := src[prefixLen:]
 
-	direction, err := detectDirection(body, maps)
-	if err != nil {
-		return nil, err
-	}
-
-	transpiledBody, err := transpileBody(body, maps, direction)
+	transpiledBody, err := transpileBody(body, maps)
 	if err != nil {
 		return nil, err
 	}
-	if direction == GoToLocal {
-		transpiledBody = compactCommasInBraces(transpiledBody)
-	}
+	transpiledBody = compactCommasInBraces(transpiledBody)
 
 	out := make([]byte, 0, len(prefix)+len(transpiledBody))
 	out = append(out, prefix...)
@@ -111,10 +234,13 @@ func TranspileFile(srcPath string, src []byte, maps Maps) ([]byte, error) {
 
 func TranspileFileLocalizedToGo(srcPath string, src []byte, maps Maps) ([]byte, error) {
 	prefixLen := buildTagPrefixLen(src)
-	prefix := src[:prefixLen]
+	prefix, err := translateBuildPrefix(src[:prefixLen], maps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", srcPath, err)
+	}
 	body := src[prefixLen:]
 
-	transpiledBody, err := transpileBodyLocalizedToGo(body, maps)
+	transpiledBody, err := transpileBodyLocalizedToGo(body, maps, isTestFile(srcPath, maps))
 	if err != nil {
 		return nil, err
 	}
@@ -122,19 +248,53 @@ func TranspileFileLocalizedToGo(srcPath string, src []byte, maps Maps) ([]byte,
 	out := make([]byte, 0, len(prefix)+len(transpiledBody))
 	out = append(out, prefix...)
 	out = append(out, transpiledBody...)
+	out, err = translateDirectives(out, maps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", srcPath, err)
+	}
 	return out, nil
 }
 
-func transpileBodyLocalizedToGo(body []byte, maps Maps) ([]byte, error) {
-	out := make([]byte, 0, len(body))
+func transpileBodyLocalizedToGo(body []byte, maps Maps, testFile bool) ([]byte, error) {
+	l := newLocalizer(maps)
+	if testFile {
+		l.tests = analyzeTestFile(body, maps)
+	}
+	return l.appendBody(make([]byte, 0, len(body)), body, 0)
+}
+
+// localizer holds the state of one localized-to-Go pass, so a file can be
+// transpiled in chunks: names escaped with '@' stay plain identifiers for the
+// rest of the file, and mangled names are computed once.
+type localizer struct {
+	maps         Maps
+	tests        *testFileInfo
+	escapedNames map[string]struct{}
+	renamed      map[string]string
+}
+
+func newLocalizer(maps Maps) *localizer {
+	return &localizer{
+		maps:         maps,
+		escapedNames: make(map[string]struct{}),
+		renamed:      make(map[string]string),
+	}
+}
+
+// appendBody appends the Go form of body to out. offset is the position of
+// body in the file, for error messages.
+func (l *localizer) appendBody(out, body []byte, offset int) ([]byte, error) {
+	maps := l.maps
 	last := 0
 	idx := 0
-	escapedNames := make(map[string]struct{})
 
 	for idx < len(body) {
-		r, size := utf8.DecodeRune(body[idx:])
-		if r == utf8.RuneError && size == 1 {
-			return nil, fmt.Errorf("invalid utf-8 at %d", idx)
+		r, size := rune(body[idx]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRune(body[idx:])
+			if r == utf8.RuneError && size == 1 {
+				return nil, fmt.Errorf("invalid utf-8 at %d", offset+idx)
+			}
 		}
 
 		if r == '/' && idx+1 < len(body) {
@@ -171,9 +331,9 @@ func transpileBodyLocalizedToGo(body []byte, maps Maps) ([]byte, error) {
 					identEnd := readIdent(body, identStart)
 					out = append(out, body[last:idx]...)
 					ident := string(body[identStart:identEnd])
-					escapedNames[ident] = struct{}{}
-					replacement := translateIdentLocalizedToGo(ident, maps, true, escapedNames)
-					out = append(out, []byte(replacement)...)
+					l.escapedNames[ident] = struct{}{}
+					replacement := translateIdentLocalizedToGo(ident, maps, true, l.escapedNames)
+					out = append(out, replacement...)
 					last = identEnd
 					idx = identEnd
 					continue
@@ -185,33 +345,51 @@ func transpileBodyLocalizedToGo(body []byte, maps Maps) ([]byte, error) {
 			identStart := idx
 			identEnd := readIdent(body, identStart)
 			out = append(out, body[last:identStart]...)
-			ident := string(body[identStart:identEnd])
-			if _, escaped := escapedNames[ident]; !escaped {
-				if !maps.AllowGoKeywords {
-					if _, ok := maps.LocalToGo[ident]; !ok {
-						if _, ok := maps.LocalPredeclared[ident]; !ok {
-							if _, ok := maps.GoToLocal[ident]; ok {
-								return nil, fmt.Errorf("go keyword %q is not allowed in .p.go; use localized keyword", ident)
-							}
-							if _, ok := maps.GoPredeclared[ident]; ok {
-								return nil, fmt.Errorf("go predeclared %q is not allowed in .p.go; use localized keyword", ident)
-							}
-						}
+			ident := body[identStart:identEnd]
+			if _, escaped := l.escapedNames[string(ident)]; !escaped && !maps.AllowGoKeywords {
+				// Identity entries are local words too; LoadKeywordMapData
+				// makes sure no other Go word doubles as a local one.
+				if _, ok := maps.Identity[string(ident)]; !ok {
+					if local, ok := maps.GoToLocal[string(ident)]; ok {
+						return nil, fmt.Errorf("go keyword %q is not allowed in .p.go; use %q", ident, local)
+					}
+					if local, ok := maps.GoPredeclared[string(ident)]; ok {
+						return nil, fmt.Errorf("go predeclared %q is not allowed in .p.go; use %q", ident, local)
 					}
 				}
 			}
-			if ident == "চ্যানেল" && shouldDropChanKeyword(body, identEnd) {
+			if string(ident) == "চ্যানেল" && shouldDropChanKeyword(body, identEnd) {
 				last = identEnd
 				idx = identEnd
 				continue
 			}
-			replacement := translateIdentLocalizedToGo(ident, maps, false, escapedNames)
-			out = append(out, []byte(replacement)...)
+			if l.tests != nil {
+				mapped, ok := l.tests.methods[offset+identStart]
+				if _, escaped := l.escapedNames[string(ident)]; !ok && !escaped {
+					mapped, ok = l.tests.funcs[offset+identStart]
+				}
+				if ok {
+					out = append(out, mapped...)
+					last = identEnd
+					idx = identEnd
+					continue
+				}
+			}
+			out = l.appendIdent(out, ident)
 			last = identEnd
 			idx = identEnd
 			continue
 		}
 
+		if isDigit(r) {
+			end := readNumber(body, idx)
+			out = append(out, body[last:idx]...)
+			out = appendNumber(out, body[idx:end], maps, LocalToGo)
+			last = end
+			idx = end
+			continue
+		}
+
 		idx += size
 	}
 
@@ -219,18 +397,42 @@ func transpileBodyLocalizedToGo(body []byte, maps Maps) ([]byte, error) {
 	return out, nil
 }
 
-func translateIdentLocalizedToGo(ident string, maps Maps, escaped bool, escapedNames map[string]struct{}) string {
-	if escaped {
-		if !isValidGoIdent(ident) {
-			return mangleIdent(ident)
-		}
-		return ident
+// appendIdent appends the Go spelling of a non-escaped identifier. Map
+// lookups index with string(ident) so the common cases do not allocate.
+func (l *localizer) appendIdent(out, ident []byte) []byte {
+	if _, escaped := l.escapedNames[string(ident)]; escaped {
+		return append(out, translateIdentLocalizedToGo(string(ident), l.maps, false, l.escapedNames)...)
+	}
+	if mapped, ok := l.maps.LocalToGo[string(ident)]; ok {
+		return append(out, mapped...)
+	}
+	if mapped, ok := l.maps.LocalPredeclared[string(ident)]; ok {
+		return append(out, mapped...)
 	}
-	if _, ok := escapedNames[ident]; ok {
-		if !isValidGoIdent(ident) {
-			return mangleIdent(ident)
+	if renamed, ok := l.renamed[string(ident)]; ok {
+		return append(out, renamed...)
+	}
+	if isASCII(ident) {
+		return append(out, ident...)
+	}
+	name := string(ident)
+	renamed := translateIdentLocalizedToGo(name, l.maps, false, l.escapedNames)
+	l.renamed[name] = renamed
+	return append(out, renamed...)
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
 		}
-		return ident
+	}
+	return true
+}
+
+func translateIdentLocalizedToGo(ident string, maps Maps, escaped bool, escapedNames map[string]struct{}) string {
+	if _, ok := escapedNames[ident]; ok || escaped {
+		return goIdent(ident, maps)
 	}
 	if mapped, ok := maps.LocalToGo[ident]; ok {
 		return mapped
@@ -238,6 +440,16 @@ func translateIdentLocalizedToGo(ident string, maps Maps, escaped bool, escapedN
 	if mapped, ok := maps.LocalPredeclared[ident]; ok {
 		return mapped
 	}
+	return goIdent(ident, maps)
+}
+
+// goIdent returns the Go name of a user identifier: its transliteration when
+// maps has a Transliterator and ident is not ASCII, else ident itself, or
+// its mangled form when it is no valid Go identifier.
+func goIdent(ident string, maps Maps) string {
+	if maps.Transliterator != nil && !isASCII([]byte(ident)) {
+		return maps.Transliterator.Name(ident)
+	}
 	if !isValidGoIdent(ident) {
 		return mangleIdent(ident)
 	}
@@ -326,43 +538,23 @@ func mangleIdent(ident string) string {
 	return "Bgo_" + hex.EncodeToString(sum[:8])
 }
 
-func detectDirection(body []byte, maps Maps) (Direction, error) {
-	seenLocal := false
-	seenGo := false
-
-	scanIdentifiers(body, func(ident string) {
-		if _, ok := maps.LocalToGo[ident]; ok {
-			seenLocal = true
-		}
-		if _, ok := maps.LocalPredeclared[ident]; ok {
-			seenLocal = true
-		}
-		if _, ok := maps.GoToLocal[ident]; ok {
-			seenGo = true
-		}
-		if _, ok := maps.GoPredeclared[ident]; ok {
-			seenGo = true
-		}
-	})
-
-	if seenGo {
-		return GoToLocal, nil
-	}
-	if seenLocal {
-		return LocalToGo, nil
-	}
-	return LocalToGo, nil
+func transpileBody(body []byte, maps Maps) ([]byte, error) {
+	return appendTranspiledBody(make([]byte, 0, len(body)), body, 0, maps)
 }
 
-func transpileBody(body []byte, maps Maps, direction Direction) ([]byte, error) {
-	out := make([]byte, 0, len(body))
+// appendTranspiledBody appends the localized form of the Go source body to
+// out. offset is the position of body in the file, for error messages.
+func appendTranspiledBody(out, body []byte, offset int, maps Maps) ([]byte, error) {
 	last := 0
 	idx := 0
 
 	for idx < len(body) {
-		r, size := utf8.DecodeRune(body[idx:])
-		if r == utf8.RuneError && size == 1 {
-			return nil, fmt.Errorf("invalid utf-8 at %d", idx)
+		r, size := rune(body[idx]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRune(body[idx:])
+			if r == utf8.RuneError && size == 1 {
+				return nil, fmt.Errorf("invalid utf-8 at %d", offset+idx)
+			}
 		}
 
 		if r == '/' && idx+1 < len(body) {
@@ -398,9 +590,7 @@ func transpileBody(body []byte, maps Maps, direction Direction) ([]byte, error)
 					identStart := idx + size
 					identEnd := readIdent(body, identStart)
 					out = append(out, body[last:idx]...)
-					ident := string(body[identStart:identEnd])
-					replacement := translateIdent(ident, maps, direction, true, false)
-					out = append(out, []byte(replacement)...)
+					out = appendIdent(out, body[identStart:identEnd], maps, true, false)
 					last = identEnd
 					idx = identEnd
 					continue
@@ -412,20 +602,26 @@ func transpileBody(body []byte, maps Maps, direction Direction) ([]byte, error)
 			identStart := idx
 			identEnd := readIdent(body, identStart)
 			out = append(out, body[last:identStart]...)
-			ident := string(body[identStart:identEnd])
+			ident := body[identStart:identEnd]
 			escapeNeeded := false
-			if direction == GoToLocal {
-				if _, ok := maps.LocalAll[ident]; ok {
-					escapeNeeded = shouldEscapeGoIdent(body, identEnd)
-				}
+			if _, ok := maps.LocalAll[string(ident)]; ok {
+				escapeNeeded = shouldEscapeGoIdent(body, identEnd)
 			}
-			replacement := translateIdent(ident, maps, direction, false, escapeNeeded)
-			out = append(out, []byte(replacement)...)
+			out = appendIdent(out, ident, maps, false, escapeNeeded)
 			last = identEnd
 			idx = identEnd
 			continue
 		}
 
+		if isDigit(r) {
+			end := readNumber(body, idx)
+			out = append(out, body[last:idx]...)
+			out = appendNumber(out, body[idx:end], maps, GoToLocal)
+			last = end
+			idx = end
+			continue
+		}
+
 		idx += size
 	}
 
@@ -433,30 +629,27 @@ func transpileBody(body []byte, maps Maps, direction Direction) ([]byte, error)
 	return out, nil
 }
 
-func translateIdent(ident string, maps Maps, direction Direction, escaped bool, escapeNeeded bool) string {
+// appendIdent appends the localized spelling of the Go identifier ident. Map
+// lookups index with string(ident) so they do not allocate.
+func appendIdent(out, ident []byte, maps Maps, escaped bool, escapeNeeded bool) []byte {
 	if escaped {
-		return ident
+		return append(out, ident...)
 	}
-	if direction == LocalToGo {
-		if mapped, ok := maps.LocalToGo[ident]; ok {
-			return mapped
-		}
-		if mapped, ok := maps.LocalPredeclared[ident]; ok {
-			return mapped
-		}
-		return ident
+	if mapped, ok := maps.GoPredeclared[string(ident)]; ok {
+		return append(out, mapped...)
 	}
-
-	if mapped, ok := maps.GoPredeclared[ident]; ok {
-		return mapped
+	if mapped, ok := maps.GoToLocal[string(ident)]; ok {
+		return append(out, mapped...)
 	}
-	if mapped, ok := maps.GoToLocal[ident]; ok {
-		return mapped
+	if maps.Transliterator != nil {
+		if original, ok := maps.Transliterator.Original(string(ident)); ok {
+			return append(out, original...)
+		}
 	}
 	if escapeNeeded {
-		return "@" + ident
+		out = append(out, '@')
 	}
-	return ident
+	return append(out, ident...)
 }
 
 func shouldEscapeGoIdent(src []byte, identEnd int) bool {
@@ -489,6 +682,16 @@ func isSpace(b byte) bool {
 }
 
 func scanIdentifiers(src []byte, fn func(ident string)) {
+	scanIdents(src, func(start, end int, escaped bool) {
+		if !escaped {
+			fn(string(src[start:end]))
+		}
+	})
+}
+
+// scanIdents reports the byte range of every identifier outside strings and
+// comments; for @-escaped identifiers the range excludes the '@'.
+func scanIdents(src []byte, fn func(start, end int, escaped bool)) {
 	idx := 0
 	for idx < len(src) {
 		r, size := utf8.DecodeRune(src[idx:])
@@ -526,7 +729,9 @@ func scanIdentifiers(src []byte, fn func(ident string)) {
 			if nsize > 0 {
 				nr, _ := utf8.DecodeRune(src[idx+size:])
 				if isIdentStart(nr) {
-					idx = readIdent(src, idx+size)
+					end := readIdent(src, idx+size)
+					fn(idx+size, end, true)
+					idx = end
 					continue
 				}
 			}
@@ -534,7 +739,7 @@ func scanIdentifiers(src []byte, fn func(ident string)) {
 
 		if isIdentStart(r) {
 			end := readIdent(src, idx)
-			fn(string(src[idx:end]))
+			fn(idx, end, false)
 			idx = end
 			continue
 		}
@@ -662,7 +867,7 @@ func buildTagPrefixLen(src []byte) int {
 		if lineNum == 1 && trimmed == "" {
 			return 0
 		}
-		if strings.HasPrefix(trimmed, "//go:build") || strings.HasPrefix(trimmed, "// +build") {
+		if isBuildLine(trimmed) {
 			pos += len(line)
 			if err != nil {
 				break
@@ -675,18 +880,30 @@ func buildTagPrefixLen(src []byte) int {
 }
 
 func compactCommasInBraces(src []byte) []byte {
-	out := make([]byte, 0, len(src))
+	var c commaCompactor
+	return c.appendCompacted(make([]byte, 0, len(src)), src)
+}
+
+type tokKind int
+
+const (
+	tokNone tokKind = iota
+	tokIdent
+	tokRBracket
+	tokOther
+)
+
+// commaCompactor removes the blanks after commas in composite literals. It
+// keeps its brace state between calls so a file can be processed in chunks.
+type commaCompactor struct {
+	prevTok    tokKind
+	lastTok    tokKind
+	braceStack []bool
+}
+
+func (c *commaCompactor) appendCompacted(out, src []byte) []byte {
+	prevTok, lastTok, braceStack := c.prevTok, c.lastTok, c.braceStack
 	idx := 0
-	type tokKind int
-	const (
-		tokNone tokKind = iota
-		tokIdent
-		tokRBracket
-		tokOther
-	)
-	prevTok := tokNone
-	lastTok := tokNone
-	var braceStack []bool
 	for idx < len(src) {
 		if src[idx] == '/' && idx+1 < len(src) {
 			if src[idx+1] == '/' {
@@ -780,5 +997,6 @@ func compactCommasInBraces(src []byte) []byte {
 		lastTok = tokOther
 		idx++
 	}
+	c.prevTok, c.lastTok, c.braceStack = prevTok, lastTok, braceStack
 	return out
 }
@@ -0,0 +1,186 @@
+package transpile
+
+import (
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// roundTripSource uses every Go keyword and the predeclared names es.json
+// spells like Go (byte, error, real).
+const roundTripSource = `package main
+
+import "errors"
+
+const limit = 10
+
+type pair struct {
+	a, b int
+}
+
+type sizer interface {
+	Size() int
+}
+
+var table = map[string]byte{"x": 1}
+
+func sum(c chan int, xs []int) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("panic")
+		}
+	}()
+	for i, x := range xs {
+		switch {
+		case x > limit:
+			fallthrough
+		case x > 0:
+			n += x
+		default:
+			continue
+		}
+		if i > limit {
+			break
+		} else {
+			n++
+		}
+	}
+	select {
+	case v := <-c:
+		n += v
+	default:
+	}
+	if n < 0 {
+		goto done
+	}
+	go func() {}()
+	var z complex128 = complex(1, 2)
+	n += int(real(z)) + len(table)
+done:
+	return n, nil
+}
+`
+
+func TestEmbeddedLocales(t *testing.T) {
+	locales := EmbeddedLocales()
+	if len(locales) == 0 {
+		t.Fatal("no embedded locales")
+	}
+	for _, locale := range locales {
+		t.Run(locale, func(t *testing.T) {
+			data, _ := EmbeddedKeywordMap(locale)
+			maps, err := LoadKeywordMapData(data, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for tok := token.BREAK; tok <= token.VAR; tok++ {
+				if _, ok := maps.GoToLocal[tok.String()]; !ok {
+					t.Errorf("no local spelling of %q", tok)
+				}
+			}
+
+			local, err := TranspileFileGoToLocal("x.go", []byte(roundTripSource), maps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d, err := DetectDirection([]byte(roundTripSource), maps); err != nil || d.Direction != GoToLocal || d.Confidence != 1 {
+				t.Errorf("DetectDirection(Go source) = %+v, %v", d, err)
+			}
+			if d, err := DetectDirection(local, maps); err != nil || d.Direction != LocalToGo || d.Confidence != 1 {
+				t.Errorf("DetectDirection(localized source) = %+v, %v\n%s", d, err, local)
+			}
+			back, err := TranspileFileLocalizedToGo("x.p.go", local, maps)
+			if err != nil {
+				t.Fatalf("strict transpile of\n%s\n: %v", local, err)
+			}
+			if string(back) != roundTripSource {
+				t.Errorf("round trip changed the source:\n%s", back)
+			}
+		})
+	}
+}
+
+func TestIdentityEntries(t *testing.T) {
+	data, _ := EmbeddedKeywordMap("es")
+	maps, err := LoadKeywordMapData(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"var", "real", "byte", "error"} {
+		if _, ok := maps.Identity[word]; !ok {
+			t.Errorf("%q is not an identity entry", word)
+		}
+	}
+	if _, ok := maps.Identity["si"]; ok {
+		t.Errorf("si is an identity entry")
+	}
+	// Identity words alone do not make a file Go.
+	src := "paquete x\n\nvar e error\n"
+	if d, _ := DetectDirection([]byte(src), maps); d.Direction != LocalToGo {
+		t.Errorf("DetectDirection(%q) = Go", src)
+	}
+	if _, err := TranspileFileLocalizedToGo("x.p.go", []byte(src), maps); err != nil {
+		t.Errorf("strict mode rejected identity entries: %v", err)
+	}
+	if _, err := TranspileFileLocalizedToGo("x.p.go", []byte("paquete x\n\nfunc f() {}\n"), maps); err == nil || !strings.Contains(err.Error(), `"funcion"`) {
+		t.Errorf("strict mode error for func = %v, want one naming funcion", err)
+	}
+}
+
+func TestKeywordMapValidation(t *testing.T) {
+	bad := map[string]string{
+		"not a keyword":     `{"keywords": {"si": "iff"}}`,
+		"both sections":     `{"keywords": {"si": "if"}, "predeclared": {"si": "len"}}`,
+		"keyword collision": `{"keywords": {"for": "if", "para": "for"}}`,
+		"name collision":    `{"keywords": {"si": "if"}, "predeclared": {"len": "cap", "longitud": "len"}}`,
+		"bad identifier":    `{"predeclared": {"x": "1x"}}`,
+	}
+	for name, data := range bad {
+		if _, err := LoadKeywordMapData([]byte(data), false); err == nil {
+			t.Errorf("%s: map accepted", name)
+		}
+	}
+
+	// Several local words for one Go word: the localized one wins over the
+	// identity entry, then the smallest.
+	data := []byte(`{"keywords": {"var": "var", "variable": "var", "si": "if", "cuando": "if"}}`)
+	for i := 0; i < 20; i++ {
+		maps, err := LoadKeywordMapData(data, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := maps.GoToLocal["var"]; got != "variable" {
+			t.Fatalf("GoToLocal[var] = %q, want variable", got)
+		}
+		if got := maps.GoToLocal["if"]; got != "cuando" {
+			t.Fatalf("GoToLocal[if] = %q, want cuando", got)
+		}
+	}
+}
+
+func TestTranspileFileMatchesLocalizedToGo(t *testing.T) {
+	data, _ := EmbeddedKeywordMap("bn")
+	maps, err := LoadKeywordMapData(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Test names, test methods and mangled names are all handled by the
+	// localized-to-Go pass.
+	src := []byte("প্যাকেজ p\n\nআমদানি \"testing\"\n\nফাংশন পরীক্ষাযোগ(t *testing.T) {\n\tবার্তা := ১\n\tt.লগ(বার্তা)\n}\n")
+	want, err := TranspileFileLocalizedToGo("x_test.p.go", src, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, direction := range []Direction{LocalToGo, AutoDirection} {
+		got, err := TranspileFile("x_test.p.go", src, maps, direction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("TranspileFile(direction %d):\n%s\nwant:\n%s", direction, got, want)
+		}
+	}
+	if !strings.Contains(string(want), "t.Log(Bgo_") {
+		t.Errorf("unexpected translation:\n%s", want)
+	}
+}
@@ -0,0 +1,129 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RewriteCoverProfile rewrites a coverage profile written by go test in the
+// generated workspace so that blocks of transpiled files refer to their .p.go
+// sources, with columns mapped through the source map. With toGenerated it
+// does the reverse, for tools that must read the generated Go files.
+func RewriteCoverProfile(moduleRoot string, profile []byte, toGenerated bool) ([]byte, error) {
+	genDir := filepath.Join(moduleRoot, GeneratedDirName)
+	modules, err := workspaceModules(genDir)
+	if err != nil {
+		return nil, err
+	}
+	sm, err := LoadSourceMap(moduleRoot)
+	if err != nil {
+		return nil, err
+	}
+	// The .p.go source and its generated file share a directory.
+	bySource := make(map[string]string, len(sm.Files))
+	for file, fm := range sm.Files {
+		bySource[path.Join(path.Dir(file), path.Base(fm.Source))] = file
+	}
+
+	var out bytes.Buffer
+	sc := bufio.NewScanner(bytes.NewReader(profile))
+	sc.Buffer(nil, 1<<20)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := sc.Text()
+		if lineNo == 1 && strings.HasPrefix(line, "mode:") || line == "" {
+			out.WriteString(line + "\n")
+			continue
+		}
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("line %d: malformed coverage block %q", lineNo, line)
+		}
+		name, block := line[:colon], line[colon+1:]
+		rel, ok := modules.genPath(name)
+		if !ok {
+			out.WriteString(line + "\n")
+			continue
+		}
+		genFile := rel
+		if toGenerated {
+			genFile, ok = bySource[rel]
+		} else {
+			_, ok = sm.Files[rel]
+		}
+		if !ok {
+			out.WriteString(line + "\n")
+			continue
+		}
+		fm := sm.Files[genFile]
+		target := path.Join(path.Dir(name), path.Base(fm.Source))
+		if toGenerated {
+			target = path.Join(path.Dir(name), path.Base(genFile))
+		}
+
+		var startLine, startCol, endLine, endCol int
+		var rest string
+		if n, _ := fmt.Sscanf(block, "%d.%d,%d.%d", &startLine, &startCol, &endLine, &endCol); n != 4 {
+			return nil, fmt.Errorf("line %d: malformed coverage block %q", lineNo, line)
+		}
+		if sp := strings.IndexByte(block, ' '); sp >= 0 {
+			rest = block[sp:]
+		}
+		startCol = mapColumn(fm.Spans, startLine, startCol, toGenerated, false)
+		endCol = mapColumn(fm.Spans, endLine, endCol, toGenerated, true)
+		out.WriteString(target + ":" +
+			strconv.Itoa(startLine) + "." + strconv.Itoa(startCol) + "," +
+			strconv.Itoa(endLine) + "." + strconv.Itoa(endCol) + rest + "\n")
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// moduleDirs maps module paths to their slash-separated directories in the
+// generated workspace.
+type moduleDirs map[string]string
+
+func workspaceModules(genDir string) (moduleDirs, error) {
+	modules := make(moduleDirs)
+	err := filepath.WalkDir(genDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != "go.mod" {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(genDir, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		if modPath := ModulePath(data); modPath != "" {
+			modules[modPath] = filepath.ToSlash(rel)
+		}
+		return nil
+	})
+	return modules, err
+}
+
+// genPath maps a file named by import path (as in coverage profiles) to its
+// path relative to the workspace, using the longest matching module path.
+func (m moduleDirs) genPath(name string) (string, bool) {
+	best := ""
+	for modPath := range m {
+		if strings.HasPrefix(name, modPath+"/") && len(modPath) > len(best) {
+			best = modPath
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return path.Join(m[best], strings.TrimPrefix(name, best+"/")), true
+}
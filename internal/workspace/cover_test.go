@@ -0,0 +1,80 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmizanur/poly-go/internal/transpile"
+)
+
+func TestRewriteCoverProfile(t *testing.T) {
+	data, _ := transpile.EmbeddedKeywordMap("bn")
+	maps, err := transpile.LoadKeywordMapData(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Line 3 has several multibyte keywords before, inside and after the
+	// function body.
+	src := "প্যাকেজ app\n\nফাংশন যোগ(ক, খ পূর্ণসংখ্যা) পূর্ণসংখ্যা { ফেরত ক + খ }\n"
+	gen, err := transpile.TranspileFileLocalizedToGo("pkg/x.p.go", []byte(src), maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	genDir := filepath.Join(root, GeneratedDirName)
+	if err := os.MkdirAll(genDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(genDir, "go.mod"), []byte("module example.com/app\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sm := newSourceMap()
+	sm.Files["pkg/x_p.go"] = FileMap{Source: "pkg/x.p.go", Spans: transpile.ReplacedSpans([]byte(src), gen)}
+	if err := writeSourceMap(genDir, sm); err != nil {
+		t.Fatal(err)
+	}
+
+	// col returns the 1-based byte column of the end (after) or start of
+	// word in line 3 of file.
+	col := func(file []byte, word string, after bool) int {
+		line := strings.Split(string(file), "\n")[2]
+		i := strings.Index(line, word)
+		if i < 0 {
+			t.Fatalf("%q not in %q", word, line)
+		}
+		if after {
+			i += len(word)
+		}
+		return i + 1
+	}
+	genProfile := "mode: set\n" +
+		fmt.Sprintf("example.com/app/pkg/x_p.go:3.%d,3.%d 1 1\n", col(gen, "{", true), col(gen, "}", true)) +
+		fmt.Sprintf("example.com/app/pkg/x_p.go:3.%d,3.%d 1 0\n", col(gen, "return", false), col(gen, "return", true)) +
+		"example.com/app/pkg/plain.go:1.1,2.2 1 0\n"
+	srcProfile := "mode: set\n" +
+		fmt.Sprintf("example.com/app/pkg/x.p.go:3.%d,3.%d 1 1\n", col([]byte(src), "{", true), col([]byte(src), "}", true)) +
+		fmt.Sprintf("example.com/app/pkg/x.p.go:3.%d,3.%d 1 0\n", col([]byte(src), "ফেরত", false), col([]byte(src), "ফেরত", true)) +
+		"example.com/app/pkg/plain.go:1.1,2.2 1 0\n"
+
+	got, err := RewriteCoverProfile(root, []byte(genProfile), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != srcProfile {
+		t.Errorf("profile for the sources:\n%s\nwant:\n%s", got, srcProfile)
+	}
+	back, err := RewriteCoverProfile(root, got, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back) != genProfile {
+		t.Errorf("profile mapped back:\n%s\nwant:\n%s", back, genProfile)
+	}
+
+	if _, err := RewriteCoverProfile(root, []byte("mode: set\nexample.com/app/pkg/x_p.go:3.1\n"), false); err == nil {
+		t.Error("malformed block accepted")
+	}
+}
@@ -0,0 +1,568 @@
+package workspace
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/newmizanur/poly-go/internal/transpile"
+)
+
+// Dependencies from the module cache that ship .p.go sources cannot be built
+// by the go command. Generate transpiles each of them once into a replacement
+// module below the cache directory and adds a replace directive for it to the
+// generated go.mod (or go.work, which overrides the replaces of its modules).
+
+// depReplaceComment marks the replace block Generate appends; SyncBack removes
+// it again.
+const depReplaceComment = "// pgo: transpiled dependencies with .p.go sources"
+
+// depCacheVersion is part of every cache key. Bump it when the transpiler
+// output changes for the same sources and map.
+const depCacheVersion = "5"
+
+// depMetaDir holds the Names of a transpiled dependency.
+const depMetaDir = "_pgo"
+
+// listedModule is a module as reported by go list.
+type listedModule struct {
+	Path    string
+	Version string
+	Dir     string
+	Main    bool
+	Replace *listedModule
+}
+
+// replaceDependencies wires up the dependencies of the generated workspace
+// that contain .p.go files. The go command cannot see the imports of packages
+// that only have .p.go files, so listing repeats until no new module shows up.
+// The result is kept in depListDir and reused while the go.mod and go.sum
+// files of the workspace stay the same.
+func (g *generator) replaceDependencies() error {
+	// Vendored builds take every package from the vendor directory, and
+	// replaces missing from its modules.txt would make it inconsistent.
+	if vendorMode(g.genDir, g.opts.ModFlag) {
+		return nil
+	}
+	modFile, gowork := filepath.Join(g.genDir, "go.work"), ""
+	if _, err := os.Stat(modFile); err == nil {
+		gowork = modFile
+	} else {
+		modFile, gowork = filepath.Join(g.genDir, "go.mod"), "off"
+		if _, err := os.Stat(modFile); err != nil {
+			return nil
+		}
+	}
+	original, err := os.ReadFile(modFile)
+	if err != nil {
+		return err
+	}
+	cacheRoot, err := g.dependencyCacheDir()
+	if err != nil {
+		return err
+	}
+
+	listKey, err := g.dependencyListKey(gowork)
+	if err != nil {
+		return err
+	}
+	listFile := filepath.Join(cacheRoot, depListDir, hashString(g.root)+".json")
+	if mods, ok := loadDependencyList(listFile, listKey); ok {
+		var replaces []string
+		for _, m := range mods {
+			dir, err := g.generateDependency(m, cacheRoot)
+			if err != nil {
+				return fmt.Errorf("%s@%s: %w", m.Path, m.Version, err)
+			}
+			replaces = append(replaces, fmt.Sprintf("%s %s => %s", m.Path, m.Version, quoteModPath(dir)))
+		}
+		if len(replaces) == 0 {
+			return nil
+		}
+		return os.WriteFile(modFile, appendDependencyReplaces(original, replaces), 0o644)
+	}
+
+	seen := make(map[string]bool)
+	var replaces []string
+	var localized []listedModule
+	for {
+		mods, err := listDependencies(g.genDir, gowork)
+		if err != nil {
+			// The go command reports the same problem more usefully when
+			// it builds.
+			g.warn(fmt.Errorf("cannot check dependencies for .p.go sources: %w", err))
+			return nil
+		}
+		added := false
+		for _, m := range mods {
+			key := m.Path + "@" + m.Version
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if !hasLocalizedSources(m.Dir) {
+				continue
+			}
+			dir, err := g.generateDependency(m, cacheRoot)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			replaces = append(replaces, fmt.Sprintf("%s %s => %s", m.Path, m.Version, quoteModPath(dir)))
+			localized = append(localized, m)
+			added = true
+		}
+		if !added {
+			return saveDependencyList(listFile, listKey, localized)
+		}
+		if err := os.WriteFile(modFile, appendDependencyReplaces(original, replaces), 0o644); err != nil {
+			return err
+		}
+	}
+}
+
+// depListDir holds the dependencies with .p.go sources that the last listing
+// found for each root, below the cache directory.
+const depListDir = "_lists"
+
+// dependencyList is a file in depListDir.
+type dependencyList struct {
+	// Key is the dependencyListKey of the workspace that was listed.
+	Key     string
+	Modules []listedModule
+}
+
+// dependencyListKey hashes the go.mod, go.sum, go.work and go.work.sum files
+// of the workspace. Module versions are immutable, so unless one of them
+// changes, go list finds the same dependencies again.
+func (g *generator) dependencyListKey(gowork string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", depCacheVersion, g.root, gowork)
+	err := filepath.WalkDir(g.genDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch d.Name() {
+		case "go.mod", "go.sum", "go.work", "go.work.sum":
+		default:
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(g.genDir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), len(data))
+		h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadDependencyList returns the modules saved in path if they were listed
+// for key and are all still in the module cache.
+func loadDependencyList(path, key string) ([]listedModule, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var list dependencyList
+	if err := json.Unmarshal(data, &list); err != nil || list.Key != key {
+		return nil, false
+	}
+	for _, m := range list.Modules {
+		if _, err := os.Stat(m.Dir); err != nil {
+			return nil, false
+		}
+	}
+	return list.Modules, true
+}
+
+func saveDependencyList(path, key string, mods []listedModule) error {
+	data, err := json.MarshalIndent(dependencyList{Key: key, Modules: mods}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// hashString returns a short hex digest of s for use in file names.
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:6])
+}
+
+func (g *generator) dependencyCacheDir() (string, error) {
+	if g.opts.CacheDir != "" {
+		return g.opts.CacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pgo", "mod"), nil
+}
+
+// listDependencies returns the non-main modules providing packages that the
+// main modules of dir import, directly or through their tests ("all"). Imports the go command cannot
+// resolve to a module, typically for lack of a go.sum entry, are looked up in
+// the module graph and downloaded.
+func listDependencies(dir, gowork string) ([]listedModule, error) {
+	out, err := goOutput(dir, gowork, "list", "-mod=readonly", "-e", "-json=ImportPath,Module,Error", "all")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var mods []listedModule
+	add := func(m *listedModule) {
+		// Replaced modules are either local directories, which the
+		// workspace handles itself, or already point elsewhere.
+		if m == nil || m.Main || m.Replace != nil || m.Dir == "" || m.Version == "" || seen[m.Path] {
+			return
+		}
+		seen[m.Path] = true
+		mods = append(mods, *m)
+	}
+	var unresolved []string
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg struct {
+			ImportPath string
+			Module     *listedModule
+			Error      *struct{ Err string }
+		}
+		if err := dec.Decode(&pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if pkg.Module == nil && pkg.Error != nil {
+			unresolved = append(unresolved, pkg.ImportPath)
+		}
+		add(pkg.Module)
+	}
+	if len(unresolved) == 0 {
+		return mods, nil
+	}
+
+	out, err = goOutput(dir, gowork, "list", "-mod=readonly", "-m", "-e", "-json", "all")
+	if err != nil {
+		return nil, err
+	}
+	var graph []listedModule
+	dec = json.NewDecoder(bytes.NewReader(out))
+	for {
+		var m listedModule
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		graph = append(graph, m)
+	}
+	for _, path := range unresolved {
+		var best *listedModule
+		for i, m := range graph {
+			if (path == m.Path || strings.HasPrefix(path, m.Path+"/")) && (best == nil || len(m.Path) > len(best.Path)) {
+				best = &graph[i]
+			}
+		}
+		if best == nil || best.Main || best.Replace != nil || seen[best.Path] {
+			continue
+		}
+		if best.Dir == "" {
+			out, err := goOutput(dir, gowork, "mod", "download", "-json", best.Path+"@"+best.Version)
+			if err != nil {
+				return nil, err
+			}
+			var dl struct{ Dir string }
+			if err := json.Unmarshal(out, &dl); err != nil {
+				return nil, err
+			}
+			best.Dir = dl.Dir
+		}
+		add(best)
+	}
+	return mods, nil
+}
+
+// goOutput runs the go command in dir and returns its standard output.
+func goOutput(dir, gowork string, args ...string) ([]byte, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK="+gowork)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// generateDependency returns the replacement module for m, generating it into
+// cacheRoot unless a previous run already did. Module versions are immutable,
+// so the version and the inputs of the transpiler make up the key.
+func (g *generator) generateDependency(m listedModule, cacheRoot string) (string, error) {
+	maps := g.maps
+	if g.opts.ModuleMaps != nil {
+		own, ok, err := g.opts.ModuleMaps(m.Dir)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			maps = own
+		}
+	}
+	// A dependency is generated once for every module that uses it, so it
+	// gets names of its own rather than ones saved by the root; they only
+	// depend on its sources. The root adopts the exported ones below.
+	if g.translit != nil && len(maps.Transliteration) > 0 {
+		tr, err := transpile.NewTransliterator(maps, nil)
+		if err != nil {
+			return "", err
+		}
+		maps.Transliterator = tr
+	}
+	key, err := dependencyKey(maps, g.opts)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(cacheRoot, filepath.FromSlash(escapeModulePath(m.Path))+"@"+m.Version+"-"+key)
+	if _, err := os.Stat(dest); err != nil {
+		if err := g.generateDependencyInto(m, maps, dest); err != nil {
+			return "", err
+		}
+	}
+	names, err := loadNames(filepath.Join(dest, depMetaDir))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for generated, original := range names.Idents {
+		g.names.Idents[generated] = original
+	}
+	for generated, original := range names.Files {
+		g.names.Files[generated] = original
+	}
+	if maps.Transliterator != nil {
+		saved, err := loadTranslitFile(filepath.Join(dest, depMetaDir))
+		if err != nil {
+			return "", err
+		}
+		if g.translit.Adopt(exportedNames(saved.Names)) {
+			g.staleNames = true
+		}
+	}
+	return dest, nil
+}
+
+// generateDependencyInto transpiles m into a temporary directory next to dest
+// and renames it, so concurrent runs never see a partial module.
+func (g *generator) generateDependencyInto(m listedModule, maps transpile.Maps, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	dep := &generator{
+		root:      m.Dir,
+		genDir:    tmp,
+		maps:      maps,
+		opts:      g.opts,
+		names:     Names{Files: make(map[string]string), Idents: make(map[string]string)},
+		sourceMap: newSourceMap(),
+		trees:     make(map[string]*tree),
+		modPaths:  make(map[string]map[string]string),
+	}
+	t := &tree{src: m.Dir, dest: tmp, maps: maps, external: true}
+	dep.trees[m.Dir] = t
+	if err := dep.generateTree(t); err != nil {
+		return err
+	}
+	// Modules that predate modules have no go.mod in the cache.
+	if _, err := os.Stat(filepath.Join(tmp, "go.mod")); os.IsNotExist(err) {
+		if err := os.WriteFile(filepath.Join(tmp, "go.mod"), []byte("module "+m.Path+"\n"), 0o644); err != nil {
+			return err
+		}
+	}
+	// The go command ignores directories starting with "_", so go mod
+	// vendor leaves the names out.
+	meta := filepath.Join(tmp, depMetaDir)
+	if err := os.MkdirAll(meta, 0o755); err != nil {
+		return err
+	}
+	if err := writeNames(meta, dep.names); err != nil {
+		return err
+	}
+	if err := saveTransliterator(meta, maps.Transliterator); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		if _, statErr := os.Stat(dest); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// dependencyKey hashes everything besides the sources that shapes the
+// generated files.
+func dependencyKey(maps transpile.Maps, opts Options) (string, error) {
+	data, err := json.Marshal(maps)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%t\x00%t\x00", depCacheVersion, opts.Locale, opts.LineDirectives, maps.Transliterator != nil)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// escapeModulePath escapes upper-case letters as the module cache does, so
+// paths differing only in case do not collide on case-insensitive file
+// systems.
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func quoteModPath(path string) string {
+	if strings.ContainsAny(path, " \t\"'`") {
+		return strconv.Quote(path)
+	}
+	return path
+}
+
+// appendDependencyReplaces adds a marked replace block to a go.mod or go.work
+// file.
+func appendDependencyReplaces(data []byte, replaces []string) []byte {
+	var b bytes.Buffer
+	b.Write(data)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	b.WriteString("\n" + depReplaceComment + "\nreplace (\n")
+	for _, r := range replaces {
+		b.WriteString("\t" + r + "\n")
+	}
+	b.WriteString(")\n")
+	return b.Bytes()
+}
+
+// stripDependencyReplaces removes the block added by appendDependencyReplaces,
+// including the blank line in front of it.
+func stripDependencyReplaces(data []byte) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == depReplaceComment {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return data
+	}
+	end := start + 1
+	if end < len(lines) && strings.TrimSpace(lines[end]) == "replace (" {
+		for end < len(lines) && strings.TrimSpace(lines[end]) != ")" {
+			end++
+		}
+		end++
+	} else if end < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[end]), "replace ") {
+		end++
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	if start > 0 && strings.TrimSpace(lines[start-1]) == "" {
+		start--
+	}
+	return []byte(strings.Join(append(lines[:start:start], lines[end:]...), ""))
+}
+
+// dependencyReplaces returns the modules ("path version") replaced by the
+// block appendDependencyReplaces added to a go.mod or go.work file.
+func dependencyReplaces(data []byte) map[string]bool {
+	replaced := make(map[string]bool)
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == depReplaceComment:
+			inBlock = true
+		case inBlock && line == ")":
+			return replaced
+		case inBlock:
+			if left, _, ok := strings.Cut(strings.TrimPrefix(line, "replace "), "=>"); ok {
+				replaced[strings.Join(strings.Fields(left), " ")] = true
+			}
+		}
+	}
+	return replaced
+}
+
+// keepDependencySums adds the lines of old, a go.sum file, that belong to
+// replaced modules and are missing from sums. The go command drops them in
+// the workspace, where those modules are directories, but the module still
+// needs them wherever it is built from the original sources.
+func keepDependencySums(sums, old []byte, replaced map[string]bool) []byte {
+	if len(replaced) == 0 || len(old) == 0 {
+		return sums
+	}
+	lines := strings.Split(strings.TrimSuffix(string(sums), "\n"), "\n")
+	if len(sums) == 0 {
+		lines = nil
+	}
+	have := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		have[line] = true
+	}
+	added := false
+	for _, line := range strings.Split(string(old), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || have[line] {
+			continue
+		}
+		if replaced[fields[0]+" "+strings.TrimSuffix(fields[1], "/go.mod")] {
+			lines = append(lines, line)
+			added = true
+		}
+	}
+	if !added {
+		return sums
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
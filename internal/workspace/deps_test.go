@@ -0,0 +1,174 @@
+package workspace
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDependencyReplaces(t *testing.T) {
+	gomod := "module example.com/app\n\nrequire example.com/greet v1.0.0\n"
+	withBlock := appendDependencyReplaces([]byte(gomod), []string{
+		"example.com/greet v1.0.0 => /cache/example.com/greet@v1.0.0-abc",
+		`example.com/wrap v1.2.0 => "/my cache/example.com/wrap@v1.2.0-abc"`,
+	})
+
+	replaced := dependencyReplaces(withBlock)
+	if len(replaced) != 2 || !replaced["example.com/greet v1.0.0"] || !replaced["example.com/wrap v1.2.0"] {
+		t.Fatalf("dependencyReplaces = %v", replaced)
+	}
+	if got := string(stripDependencyReplaces(withBlock)); got != gomod {
+		t.Fatalf("stripDependencyReplaces:\n%s\nwant:\n%s", got, gomod)
+	}
+	if got := string(stripDependencyReplaces([]byte(gomod))); got != gomod {
+		t.Fatalf("stripDependencyReplaces changed a file without replaces:\n%s", got)
+	}
+}
+
+func TestKeepDependencySums(t *testing.T) {
+	old := "example.com/greet v1.0.0 h1:aaa=\n" +
+		"example.com/greet v1.0.0/go.mod h1:bbb=\n" +
+		"example.com/other v0.1.0 h1:ccc=\n" +
+		"example.com/other v0.1.0/go.mod h1:ddd=\n"
+	tidied := "example.com/other v0.2.0 h1:eee=\n" +
+		"example.com/other v0.2.0/go.mod h1:fff=\n"
+	replaced := map[string]bool{"example.com/greet v1.0.0": true}
+
+	got := string(keepDependencySums([]byte(tidied), []byte(old), replaced))
+	want := "example.com/greet v1.0.0 h1:aaa=\n" +
+		"example.com/greet v1.0.0/go.mod h1:bbb=\n" +
+		tidied
+	if got != want {
+		t.Fatalf("keepDependencySums:\n%s\nwant:\n%s", got, want)
+	}
+	if got := string(keepDependencySums([]byte(tidied), []byte(old), nil)); got != tidied {
+		t.Fatalf("keepDependencySums without replaces:\n%s", got)
+	}
+}
+
+// useModuleProxy serves the given modules (path@version → files) from a
+// file:// GOPROXY with a fresh module cache.
+func useModuleProxy(t *testing.T, modules map[string]map[string]string) {
+	t.Helper()
+	proxy := t.TempDir()
+	for mod, files := range modules {
+		path, version, _ := strings.Cut(mod, "@")
+		dir := filepath.Join(proxy, filepath.FromSlash(path), "@v")
+		writeTree(t, dir, map[string]string{
+			"list":            version + "\n",
+			version + ".info": `{"Version":"` + version + `"}`,
+			version + ".mod":  files["go.mod"],
+		})
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range files {
+			w, err := zw.Create(mod + "/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, content)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, version+".zip"), buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(proxy))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GOFLAGS", "-modcacherw")
+	t.Setenv("GOTOOLCHAIN", "local")
+}
+
+func TestDependencyTransliteration(t *testing.T) {
+	useModuleProxy(t, map[string]map[string]string{
+		"example.com/dep@v1.0.0": {
+			"go.mod":   "module example.com/dep\n\ngo 1.21\n",
+			"dep.p.go": "প্যাকেজ dep\n\nফাংশন যোগফল(ক, খ পূর্ণসংখ্যা) পূর্ণসংখ্যা {\n\tফেরত ক + খ\n}\n",
+		},
+	})
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"go.mod":    "module ex\n\ngo 1.21\n\nrequire example.com/dep v1.0.0\n",
+		"pgo.json":  `{"transliterate": true}`,
+		"main.p.go": "প্যাকেজ main\n\nআমদানি \"example.com/dep\"\n\nফাংশন main() {\n\t_ = dep.যোগফল(1, 2)\n}\n",
+		// On its own, the root would call যোগফল Jogafal_2.
+		"other.go": "package main\n\nvar Jogafal = 0\n",
+	})
+	opts := Options{CacheDir: t.TempDir()}
+	for run := 1; run <= 2; run++ {
+		if err := Generate(root, loadMaps(t, "bn"), opts); err != nil {
+			t.Fatal(err)
+		}
+		genDir := filepath.Join(root, GeneratedDirName)
+		out, err := os.ReadFile(filepath.Join(genDir, "main_p.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(out), "dep.Jogafal(1, 2)") {
+			t.Errorf("run %d: main_p.go:\n%s", run, out)
+		}
+		saved := readTranslitFile(t, root)
+		if !reflect.DeepEqual(saved.Dependencies, map[string]string{"যোগফল": "Jogafal"}) {
+			t.Errorf("run %d: saved dependency names %v", run, saved.Dependencies)
+		}
+		cmd := exec.Command("go", "build", "-mod=mod", "./...")
+		cmd.Dir = genDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("run %d: go build: %v\n%s", run, err, out)
+		}
+	}
+}
+
+func TestDependencyListCache(t *testing.T) {
+	useModuleProxy(t, map[string]map[string]string{
+		"example.com/dep@v1.0.0": {
+			"go.mod":   "module example.com/dep\n\ngo 1.21\n",
+			"dep.p.go": "প্যাকেজ dep\n\nফাংশন F() {}\n",
+		},
+	})
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"go.mod":  "module ex\n\ngo 1.21\n\nrequire example.com/dep v1.0.0\n",
+		"main.go": "package main\n\nimport \"example.com/dep\"\n\nfunc main() { dep.F() }\n",
+	})
+	var warnings []error
+	opts := Options{CacheDir: t.TempDir(), Warn: func(err error) { warnings = append(warnings, err) }}
+	generate := func() string {
+		t.Helper()
+		warnings = nil
+		if err := Generate(root, loadMaps(t, "bn"), opts); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(root, GeneratedDirName, "go.mod"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if mod := generate(); !strings.Contains(mod, "example.com/dep v1.0.0 =>") || len(warnings) > 0 {
+		t.Fatalf("first run: warnings %v, go.mod:\n%s", warnings, mod)
+	}
+
+	// Without a go command, only the saved listing can find the dependency.
+	t.Setenv("PATH", "")
+	if mod := generate(); !strings.Contains(mod, "example.com/dep v1.0.0 =>") || len(warnings) > 0 {
+		t.Errorf("second run listed the dependencies again: warnings %v, go.mod:\n%s", warnings, mod)
+	}
+
+	writeTree(t, root, map[string]string{
+		"go.mod": "module ex\n\ngo 1.21\n\nrequire example.com/dep v1.0.0 // changed\n",
+	})
+	generate()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "cannot check dependencies") {
+		t.Errorf("run after a go.mod change: warnings %v, want a failed listing", warnings)
+	}
+}
@@ -0,0 +1,69 @@
+package workspace
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/newmizanur/poly-go/internal/transpile"
+)
+
+// checkEmbedPatterns resolves the //go:embed patterns of a transpiled file
+// against the directory of its original source, so mistakes are reported
+// against the user's tree rather than the generated copy. It returns the
+// matched files and directories.
+func checkEmbedPatterns(srcPath, rel string, goSrc []byte) ([]string, error) {
+	directives, err := transpile.EmbedPatterns(goSrc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	dir := filepath.Dir(srcPath)
+	var all []string
+	for _, directive := range directives {
+		for _, pattern := range directive.Patterns {
+			pattern = strings.TrimPrefix(pattern, "all:")
+			matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: pattern %s: %v", rel, directive.Line, pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s:%d: pattern %s: no matching files found", rel, directive.Line, pattern)
+			}
+			all = append(all, matches...)
+		}
+	}
+	return all, nil
+}
+
+// copyEmbedTargets copies the embedded files of a tree that the walk left
+// out, e.g. because an ignore file matches a build output directory.
+func copyEmbedTargets(srcRoot, destRoot string, targets []string) error {
+	for _, target := range targets {
+		err := filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(srcRoot, path)
+			if err != nil {
+				return err
+			}
+			out := filepath.Join(destRoot, rel)
+			if d.IsDir() {
+				return os.MkdirAll(out, 0o755)
+			}
+			if _, err := os.Lstat(out); err == nil {
+				return nil
+			}
+			if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+				return err
+			}
+			return copyFile(path, out)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigFileName is the optional configuration file at the root of a tree.
+const ConfigFileName = "pgo.json"
+
+// Config is the content of ConfigFileName.
+type Config struct {
+	// Exclude lists extra paths to leave out of the workspace, and Include
+	// paths to keep although an ignore file or Exclude matches them. Both use
+	// .gitignore syntax relative to the directory of the config file.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// KeywordCheck says what to do with .go files that use localized
+	// keywords; empty means CheckError.
+	KeywordCheck CheckMode `json:"keyword_check,omitempty"`
+	// Transliterate gives non-ASCII identifiers Latin names (see
+	// Options.Transliterate).
+	Transliterate bool `json:"transliterate,omitempty"`
+}
+
+// LoadConfig reads the ConfigFileName of dir. A missing file yields an empty
+// Config.
+func LoadConfig(dir string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(filepath.Join(dir, ConfigFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", filepath.Join(dir, ConfigFileName), err)
+	}
+	return cfg, nil
+}
+
+// ignoreFileNames are read in every directory of a tree, in this order, so
+// .pgoignore can re-include what .gitignore leaves out.
+var ignoreFileNames = []string{".gitignore", ".pgoignore"}
+
+// goSourceExts are the file types the go command may compile. They are kept
+// even when ignored, since ignored Go files are typically generated code the
+// build still needs.
+var goSourceExts = map[string]bool{
+	".go": true, ".s": true, ".S": true, ".sx": true, ".c": true, ".h": true,
+	".cc": true, ".cpp": true, ".cxx": true, ".hh": true, ".hpp": true, ".hxx": true,
+	".m": true, ".f": true, ".F": true, ".for": true, ".f90": true,
+	".syso": true, ".swig": true, ".swigcxx": true,
+}
+
+// treeFilter decides which files of a source tree are mirrored into the
+// workspace.
+type treeFilter struct {
+	root string
+	// files holds the rules of ignore files, outer directories first.
+	files []ignoreRule
+	// config holds Exclude and then Include rules; they apply after files.
+	config []ignoreRule
+	// ignoredDirs holds the directories entered although ignored; what they
+	// contain is ignored unless a later rule says otherwise.
+	ignoredDirs map[string]bool
+}
+
+// newTreeFilter returns the filter for the tree at root. Besides the ignore
+// files found while walking (see enterDir), it uses the .gitignore files of
+// the directories above root up to the top of its git repository.
+func newTreeFilter(root string, opts Options) (*treeFilter, error) {
+	f := &treeFilter{root: root, ignoredDirs: make(map[string]bool)}
+	var parents []string
+	for dir := root; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			// Not in a git repository: ancestors' ignore files do not apply.
+			parents = nil
+			break
+		}
+		dir = parent
+		parents = append(parents, dir)
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		rules, err := readIgnoreFile(filepath.Join(parents[i], ".gitignore"), parents[i])
+		if err != nil {
+			return nil, err
+		}
+		f.files = append(f.files, rules...)
+	}
+
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range append(cfg.Exclude, opts.Exclude...) {
+		if rule, ok := parseIgnoreRule(pattern, root); ok {
+			f.config = append(f.config, rule)
+		}
+	}
+	for _, pattern := range append(cfg.Include, opts.Include...) {
+		if rule, ok := parseIgnoreRule(pattern, root); ok {
+			rule.negate = !rule.negate
+			f.config = append(f.config, rule)
+		}
+	}
+	return f, nil
+}
+
+// enterDir adds the ignore files of dir. Directories must be entered before
+// their contents are checked. Ignored directories are entered as well: the
+// Go sources in them are still needed.
+func (f *treeFilter) enterDir(dir string) error {
+	if f.skip(dir, true) {
+		f.ignoredDirs[dir] = true
+	}
+	for _, name := range ignoreFileNames {
+		rules, err := readIgnoreFile(filepath.Join(dir, name), dir)
+		if err != nil {
+			return err
+		}
+		f.files = append(f.files, rules...)
+	}
+	return nil
+}
+
+// skip reports whether path is left out of the workspace. testdata
+// directories and Go sources are always kept.
+func (f *treeFilter) skip(path string, isDir bool) bool {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil {
+		return false
+	}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if part == "testdata" {
+			return false
+		}
+	}
+	name := filepath.Base(path)
+	if !isDir && (goSourceExts[filepath.Ext(name)] || isModFileName(name)) {
+		return false
+	}
+	ignored := f.ignoredDirs[filepath.Dir(path)]
+	for _, rules := range [][]ignoreRule{f.files, f.config} {
+		for _, rule := range rules {
+			if rule.match(path, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func isModFileName(name string) bool {
+	return name == "go.mod" || name == "go.sum" || name == "go.work" || name == "go.work.sum"
+}
+
+// ignoreRule is one line of an ignore file.
+type ignoreRule struct {
+	base     string // directory the pattern is relative to
+	pattern  string // slash-separated, without "!" and surrounding slashes
+	negate   bool
+	dirOnly  bool
+	anchored bool // matched against the path below base, not the base name
+}
+
+func readIgnoreFile(file, base string) ([]ignoreRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var rules []ignoreRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if rule, ok := parseIgnoreRule(sc.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, sc.Err()
+}
+
+// parseIgnoreRule parses a line in .gitignore syntax.
+func parseIgnoreRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	// Trailing spaces are ignored unless escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+func (r ignoreRule) match(p string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(r.base, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// stands for any number of segments.
+func matchSegments(pattern, segs []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pattern[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segs[0]); !ok {
+			return false
+		}
+		pattern, segs = pattern[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
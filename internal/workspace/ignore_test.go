@@ -0,0 +1,61 @@
+package workspace
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	root := filepath.FromSlash("/src/app")
+	f := &treeFilter{root: root}
+	for _, line := range []string{
+		"# comment",
+		"node_modules/",
+		"/bin",
+		"*.tmp",
+		"!keep.tmp",
+		"docs/**/*.pdf",
+		`\#literal`,
+	} {
+		if rule, ok := parseIgnoreRule(line, root); ok {
+			f.files = append(f.files, rule)
+		}
+	}
+	if rule, ok := parseIgnoreRule("data/*.csv", root); ok {
+		f.config = append(f.config, rule)
+	}
+	if rule, ok := parseIgnoreRule("data/keep.csv", root); ok {
+		rule.negate = true
+		f.config = append(f.config, rule)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		skip  bool
+	}{
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"node_modules", false, false},
+		{"bin", true, true},
+		{"cmd/bin", true, false},
+		{"a.tmp", false, true},
+		{"sub/b.tmp", false, true},
+		{"keep.tmp", false, false},
+		{"docs/a.pdf", false, true},
+		{"docs/x/y/a.pdf", false, true},
+		{"other/docs/a.pdf", false, false},
+		{"#literal", false, true},
+		{"data/a.csv", false, true},
+		{"data/keep.csv", false, false},
+		{"testdata/a.tmp", false, false},
+		{"gen.go", false, false},
+		{"zz.tmp.go", false, false},
+		{"go.sum", false, false},
+	}
+	for _, tt := range tests {
+		if got := f.skip(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir); got != tt.skip {
+			t.Errorf("skip(%s, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.skip)
+		}
+	}
+}
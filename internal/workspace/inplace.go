@@ -0,0 +1,362 @@
+package workspace
+
+import (
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/newmizanur/poly-go/internal/transpile"
+)
+
+// PublishTag separates the two halves of a published module: .p.go sources
+// require it, and the Go files GenerateInPlace writes next to them exclude it.
+// The go command never sets it, so plain Go users build the generated files,
+// while pgo treats it as set when it transpiles the sources.
+const PublishTag = "polygo"
+
+// inPlaceHeader starts every file written by GenerateInPlace. It follows the
+// "Code generated ... DO NOT EDIT." convention recognized by Go tools.
+const inPlaceHeader = "// Code generated by pgo from "
+
+// InPlaceChange is a file GenerateInPlace wrote or removed, or in check mode
+// found out of date.
+type InPlaceChange struct {
+	// Path is relative to the root, with forward slashes.
+	Path   string
+	Reason string
+}
+
+// GenerateInPlace writes the Go translation of every .p.go file below root
+// next to its source, so the module builds with the plain go command. Each
+// output is guarded by //go:build !polygo and starts with a generated-code
+// header; sources without a build constraint get //go:build polygo, so the go
+// command skips them. Outputs whose source is gone are removed.
+//
+// With check set nothing is written: the returned changes are the files that
+// are missing, out of date for the current sources and map, or orphaned.
+//
+// With transliteration enabled the names are kept in TranslitFileName at
+// root, which is reported like the outputs when it changes.
+func GenerateInPlace(root string, maps transpile.Maps, opts Options, check bool) ([]InPlaceChange, error) {
+	var changes []InPlaceChange
+	report := func(path, reason string) error {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, InPlaceChange{Path: filepath.ToSlash(rel), Reason: reason})
+		return nil
+	}
+
+	filter, err := newTreeFilter(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	translit, err := loadTransliterator(root, maps, opts)
+	if err != nil {
+		return nil, err
+	}
+	if translit != nil {
+		if err := reserveNames(translit, root); err != nil {
+			return nil, err
+		}
+		maps.Transliterator = translit
+	}
+	expected := make(map[string]bool)
+	var outputs []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (name == GeneratedDirName || name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") || filter.skip(path, true)) {
+				return fs.SkipDir
+			}
+			return filter.enterDir(path)
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(name, ".p.go") {
+			if filepath.Ext(name) == ".go" && isInPlaceOutput(path) {
+				outputs = append(outputs, path)
+			}
+			return nil
+		}
+		if !shouldIncludeLocalized(rel, opts.Locale) {
+			return nil
+		}
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		tagged, err := requirePublishTag(src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		if !bytes.Equal(tagged, src) {
+			if check {
+				if err := report(path, "missing //go:build "+PublishTag); err != nil {
+					return err
+				}
+			} else {
+				if err := os.WriteFile(path, tagged, 0o644); err != nil {
+					return err
+				}
+				if err := report(path, "added //go:build "+PublishTag); err != nil {
+					return err
+				}
+			}
+		}
+
+		gen, err := transpile.TranspileFileLocalizedToGo(rel, tagged, maps)
+		if err != nil {
+			return err
+		}
+		out, ok, err := inPlaceFile(name, gen)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		if !ok {
+			return nil
+		}
+		outPath := filepath.Join(filepath.Dir(path), transpile.GoFileName(name, maps))
+		expected[outPath] = true
+		old, err := os.ReadFile(outPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		switch {
+		case err == nil && bytes.Equal(old, out):
+			return nil
+		case check && err != nil:
+			return report(outPath, "missing")
+		case check:
+			return report(outPath, "out of date")
+		}
+		if err := os.WriteFile(outPath, out, 0o644); err != nil {
+			return err
+		}
+		return report(outPath, "written")
+	})
+	if err != nil {
+		return changes, err
+	}
+
+	for _, path := range outputs {
+		if expected[path] {
+			continue
+		}
+		if check {
+			if err := report(path, "orphaned"); err != nil {
+				return changes, err
+			}
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return changes, err
+		}
+		if err := report(path, "removed"); err != nil {
+			return changes, err
+		}
+	}
+	if translit != nil && translit.Changed() {
+		path := filepath.Join(root, TranslitFileName)
+		if check {
+			if err := report(path, "out of date"); err != nil {
+				return changes, err
+			}
+		} else {
+			if err := saveTransliterator(root, translit); err != nil {
+				return changes, err
+			}
+			if err := report(path, "written"); err != nil {
+				return changes, err
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// isInPlaceOutput reports whether the Go file at path was written by
+// GenerateInPlace.
+func isInPlaceOutput(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, len(inPlaceHeader))
+	n, _ := f.Read(buf)
+	return string(buf[:n]) == inPlaceHeader
+}
+
+// requirePublishTag returns src with a build constraint that requires
+// PublishTag: an existing //go:build line gets "polygo &&" in front, and a
+// file without one gets //go:build polygo at the top.
+func requirePublishTag(src []byte) ([]byte, error) {
+	lines := strings.SplitAfter(string(src), "\n")
+	idx, expr, err := findBuildConstraint(lines)
+	if err != nil {
+		return nil, err
+	}
+	if idx < 0 {
+		for _, line := range lines {
+			if strings.HasPrefix(strings.TrimSpace(line), "//pgo:build") {
+				return nil, fmt.Errorf("//pgo:build cannot be combined with the //go:build line of published sources; write the constraint as //go:build %s && <Go tags>", PublishTag)
+			}
+		}
+		return append([]byte("//go:build "+PublishTag+"\n\n"), src...), nil
+	}
+	if _, constant := withTag(expr, PublishTag, false); constant != nil && !*constant {
+		return src, nil
+	}
+	expr = &constraint.AndExpr{X: &constraint.TagExpr{Tag: PublishTag}, Y: expr}
+	lines[idx] = "//go:build " + expr.String() + lineEnding(lines[idx])
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// inPlaceFile turns the Go translation gen of the source name into the file
+// GenerateInPlace writes: a generated-code header, and the constraint of the
+// source with PublishTag negated. ok is false when the source is never built.
+func inPlaceFile(name string, gen []byte) (out []byte, ok bool, err error) {
+	lines := strings.SplitAfter(string(gen), "\n")
+	idx, expr, err := findBuildConstraint(lines)
+	if err != nil {
+		return nil, false, err
+	}
+	var guard constraint.Expr = &constraint.NotExpr{X: &constraint.TagExpr{Tag: PublishTag}}
+	if idx >= 0 {
+		rest, constant := withTag(expr, PublishTag, true)
+		if constant != nil && !*constant {
+			return nil, false, nil
+		}
+		if rest != nil {
+			guard = &constraint.AndExpr{X: guard, Y: rest}
+		}
+		lines = append(lines[:idx:idx], lines[idx+1:]...)
+	}
+	body := strings.TrimLeft(strings.Join(lines, ""), "\r\n")
+
+	var b strings.Builder
+	b.WriteString(inPlaceHeader + name + ". DO NOT EDIT.\n\n")
+	b.WriteString("//go:build " + guard.String() + "\n\n")
+	b.WriteString(body)
+	return []byte(b.String()), true, nil
+}
+
+// assumePublishTag rewrites the build constraint of a transpiled file for
+// the generated workspace, where PublishTag counts as set. A constraint that
+// becomes always true is blanked, keeping lines in place.
+func assumePublishTag(gen []byte) []byte {
+	if !bytes.Contains(gen, []byte(PublishTag)) {
+		return gen
+	}
+	lines := strings.SplitAfter(string(gen), "\n")
+	idx, expr, err := findBuildConstraint(lines)
+	if err != nil || idx < 0 {
+		return gen
+	}
+	rest, constant := withTag(expr, PublishTag, true)
+	switch {
+	case constant == nil:
+		lines[idx] = "//go:build " + rest.String() + lineEnding(lines[idx])
+	case *constant:
+		lines[idx] = lineEnding(lines[idx])
+	default:
+		lines[idx] = "//go:build ignore" + lineEnding(lines[idx])
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// findBuildConstraint returns the index and expression of the //go:build
+// line in the leading comment block of a file, or -1.
+func findBuildConstraint(lines []string) (int, constraint.Expr, error) {
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "//") {
+			break
+		}
+		if constraint.IsGoBuild(trimmed) {
+			expr, err := constraint.Parse(trimmed)
+			if err != nil {
+				return -1, nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			return i, expr, nil
+		}
+	}
+	return -1, nil, nil
+}
+
+func lineEnding(line string) string {
+	if strings.HasSuffix(line, "\r\n") {
+		return "\r\n"
+	}
+	if strings.HasSuffix(line, "\n") {
+		return "\n"
+	}
+	return ""
+}
+
+// withTag partially evaluates x with tag set to value. It returns the
+// remaining expression, or a nil expression and the result when x no longer
+// depends on any other tag.
+func withTag(x constraint.Expr, tag string, value bool) (constraint.Expr, *bool) {
+	result := func(b bool) (constraint.Expr, *bool) { return nil, &b }
+	switch x := x.(type) {
+	case *constraint.TagExpr:
+		if x.Tag == tag {
+			return result(value)
+		}
+		return x, nil
+	case *constraint.NotExpr:
+		rest, constant := withTag(x.X, tag, value)
+		if constant != nil {
+			return result(!*constant)
+		}
+		return &constraint.NotExpr{X: rest}, nil
+	case *constraint.AndExpr, *constraint.OrExpr:
+		var left, right constraint.Expr
+		isAnd := false
+		if and, ok := x.(*constraint.AndExpr); ok {
+			left, right, isAnd = and.X, and.Y, true
+		} else {
+			or := x.(*constraint.OrExpr)
+			left, right = or.X, or.Y
+		}
+		lx, lc := withTag(left, tag, value)
+		rx, rc := withTag(right, tag, value)
+		// For &&, false decides and true drops out; for || the reverse.
+		for _, c := range []*bool{lc, rc} {
+			if c != nil && *c != isAnd {
+				return result(!isAnd)
+			}
+		}
+		switch {
+		case lc != nil && rc != nil:
+			return result(isAnd)
+		case lc != nil:
+			return rx, nil
+		case rc != nil:
+			return lx, nil
+		case isAnd:
+			return &constraint.AndExpr{X: lx, Y: rx}, nil
+		default:
+			return &constraint.OrExpr{X: lx, Y: rx}, nil
+		}
+	}
+	return x, nil
+}
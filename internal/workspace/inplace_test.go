@@ -0,0 +1,153 @@
+package workspace
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readTree returns the files below root by slash-separated path.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestGenerateInPlace(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"go.mod": "module ex\n\ngo 1.21\n",
+		"a.p.go": "//go:build polygo\n\nপ্যাকেজ main\n\nফাংশন main() {}\n",
+		"b.p.go": "প্যাকেজ main\n\nফাংশন b() {}\n",
+		"c.p.go": "//go:build polygo\n\nপ্যাকেজ main\n\nফাংশন c() {}\n",
+		"c_p.go": inPlaceHeader + "c.p.go. DO NOT EDIT.\n\n//go:build !polygo\n\npackage main\n\nfunc old() {}\n",
+		"d_p.go": inPlaceHeader + "d.p.go. DO NOT EDIT.\n\n//go:build !polygo\n\npackage main\n",
+	})
+	maps := loadMaps(t, "bn")
+	before := readTree(t, root)
+
+	changes, err := GenerateInPlace(root, maps, Options{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InPlaceChange{
+		{"a_p.go", "missing"},
+		{"b.p.go", "missing //go:build polygo"},
+		{"b_p.go", "missing"},
+		{"c_p.go", "out of date"},
+		{"d_p.go", "orphaned"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("check: got %v, want %v", changes, want)
+	}
+	if after := readTree(t, root); !reflect.DeepEqual(after, before) {
+		t.Errorf("check changed the tree:\n%v\nwant:\n%v", after, before)
+	}
+
+	changes, err = GenerateInPlace(root, maps, Options{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []InPlaceChange{
+		{"a_p.go", "written"},
+		{"b.p.go", "added //go:build polygo"},
+		{"b_p.go", "written"},
+		{"c_p.go", "written"},
+		{"d_p.go", "removed"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("generate: got %v, want %v", changes, want)
+	}
+	if changes, err := GenerateInPlace(root, maps, Options{}, true); err != nil || len(changes) > 0 {
+		t.Errorf("check after generating: %v, %v", changes, err)
+	}
+
+	// The plain go command builds the outputs and skips the sources.
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = root
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go build: %v\n%s", err, out)
+	}
+}
+
+func TestRequirePublishTag(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{"package x\n", "//go:build polygo\n\npackage x\n"},
+		{"//go:build linux\n\npackage x\n", "//go:build polygo && linux\n\npackage x\n"},
+		{"//go:build linux || darwin\n\npackage x\n", "//go:build polygo && (linux || darwin)\n\npackage x\n"},
+		{"//go:build polygo && linux\n\npackage x\n", "//go:build polygo && linux\n\npackage x\n"},
+	}
+	for _, tt := range tests {
+		got, err := requirePublishTag([]byte(tt.src))
+		if err != nil {
+			t.Fatalf("requirePublishTag(%q): %v", tt.src, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("requirePublishTag(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+	if _, err := requirePublishTag([]byte("//pgo:build লিনাক্স\n\npackage x\n")); err == nil {
+		t.Errorf("requirePublishTag accepted a //pgo:build line")
+	}
+}
+
+func TestInPlaceFile(t *testing.T) {
+	tests := []struct{ gen, want string }{
+		{
+			"//go:build polygo\n\npackage x\n",
+			"// Code generated by pgo from x.p.go. DO NOT EDIT.\n\n//go:build !polygo\n\npackage x\n",
+		},
+		{
+			"// Package x does things.\n//go:build polygo && (linux || darwin)\n\npackage x\n",
+			"// Code generated by pgo from x.p.go. DO NOT EDIT.\n\n//go:build !polygo && (linux || darwin)\n\n// Package x does things.\n\npackage x\n",
+		},
+	}
+	for _, tt := range tests {
+		got, ok, err := inPlaceFile("x.p.go", []byte(tt.gen))
+		if err != nil || !ok {
+			t.Fatalf("inPlaceFile(%q) = %v, %v", tt.gen, ok, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("inPlaceFile(%q) =\n%s\nwant:\n%s", tt.gen, got, tt.want)
+		}
+	}
+	if _, ok, _ := inPlaceFile("x.p.go", []byte("//go:build polygo && !polygo\n\npackage x\n")); ok {
+		t.Errorf("inPlaceFile wrote a file that is never built")
+	}
+}
+
+func TestAssumePublishTag(t *testing.T) {
+	tests := []struct{ gen, want string }{
+		{"//go:build polygo\n\npackage x\n", "\n\npackage x\n"},
+		{"//go:build polygo && linux\n\npackage x\n", "//go:build linux\n\npackage x\n"},
+		{"//go:build !polygo\n\npackage x\n", "//go:build ignore\n\npackage x\n"},
+		{"//go:build polygo || windows\n\npackage x\n", "\n\npackage x\n"},
+		{"//go:build linux\n\npackage x\n", "//go:build linux\n\npackage x\n"},
+	}
+	for _, tt := range tests {
+		if got := string(assumePublishTag([]byte(tt.gen))); got != tt.want {
+			t.Errorf("assumePublishTag(%q) = %q, want %q", tt.gen, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package workspace
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FindRoot returns the directory PolyGo generates a workspace for: the
+// directory of the go.work file the go command would use from start, or else
+// the nearest module root.
+func FindRoot(start string) (string, error) {
+	switch gowork := os.Getenv("GOWORK"); gowork {
+	case "off":
+		return FindModuleRoot(start)
+	case "":
+	default:
+		return filepath.Dir(gowork), nil
+	}
+	for dir := start; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "go.work")); err == nil {
+			return dir, nil
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return FindModuleRoot(start)
+}
+
+// ModulePath returns the module path declared in go.mod data, or "".
+func ModulePath(goMod []byte) string {
+	for _, line := range strings.Split(string(goMod), "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module")
+		if !ok || rest == "" || rest[0] != ' ' && rest[0] != '\t' && rest[0] != '"' {
+			continue
+		}
+		rest, _, _ = strings.Cut(rest, "//")
+		rest = strings.TrimSpace(rest)
+		if unquoted, err := strconv.Unquote(rest); err == nil {
+			rest = unquoted
+		}
+		return rest
+	}
+	return ""
+}
+
+// rewriteModPaths rewrites the file system paths of a go.mod file (replace
+// targets) or go.work file (use entries and replace targets). fn gets each
+// path as written and returns its replacement. Import paths, versions and
+// comments are kept.
+func rewriteModPaths(data []byte, isWork bool, fn func(string) string) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	block := ""
+	for i, line := range lines {
+		code, comment := line, ""
+		if idx := strings.Index(line, "//"); idx >= 0 {
+			code, comment = line[:idx], line[idx:]
+		}
+		trimmed := strings.TrimSpace(code)
+		verb := ""
+		switch {
+		case block != "" && trimmed == ")":
+			block = ""
+			continue
+		case block != "":
+			verb = block
+		default:
+			fields := strings.Fields(trimmed)
+			if len(fields) == 0 {
+				continue
+			}
+			verb = fields[0]
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, verb))
+			if trimmed == "(" {
+				block = verb
+				continue
+			}
+		}
+
+		var target string
+		switch {
+		case verb == "replace":
+			_, after, ok := strings.Cut(trimmed, "=>")
+			if !ok {
+				continue
+			}
+			target = firstModField(after)
+			if !isFilePath(target) {
+				continue
+			}
+		case verb == "use" && isWork:
+			target = firstModField(trimmed)
+		default:
+			continue
+		}
+		if target == "" {
+			continue
+		}
+		path := target
+		if unquoted, err := strconv.Unquote(target); err == nil {
+			path = unquoted
+		}
+		replaced := fn(path)
+		if replaced == path {
+			continue
+		}
+		quoted := replaced
+		if strings.ContainsAny(replaced, " \t\"'`") || strings.HasPrefix(target, `"`) || strings.HasPrefix(target, "`") {
+			quoted = strconv.Quote(replaced)
+		}
+		idx := strings.LastIndex(code, target)
+		lines[i] = code[:idx] + quoted + code[idx+len(target):] + comment
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// firstModField returns the first field of a go.mod line, keeping quotes.
+func firstModField(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	if s[0] == '"' || s[0] == '`' {
+		if quoted, err := strconv.QuotedPrefix(s); err == nil {
+			return quoted
+		}
+	}
+	if idx := strings.IndexAny(s, " \t"); idx >= 0 {
+		return s[:idx]
+	}
+	return s
+}
+
+// isFilePath reports whether a replace target is a directory rather than a
+// module path, following the go command's rule.
+func isFilePath(target string) bool {
+	path := target
+	if unquoted, err := strconv.Unquote(target); err == nil {
+		path = unquoted
+	}
+	return filepath.IsAbs(path) || path == "." || path == ".." ||
+		strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") ||
+		strings.HasPrefix(path, `.\`) || strings.HasPrefix(path, `..\`)
+}
+
+const modPathsFileName = ".pgo_modpaths.json"
+
+func writeModPaths(genDir string, modPaths map[string]map[string]string) error {
+	data, err := json.MarshalIndent(modPaths, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(genDir, modPathsFileName), data, 0o644)
+}
+
+func loadModPaths(genDir string) (map[string]map[string]string, error) {
+	var modPaths map[string]map[string]string
+	data, err := os.ReadFile(filepath.Join(genDir, modPathsFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(data, &modPaths)
+	return modPaths, err
+}
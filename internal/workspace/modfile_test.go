@@ -0,0 +1,58 @@
+package workspace
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteModPaths(t *testing.T) {
+	gomod := `module example.com/app
+
+require example.com/other v1.2.3
+
+replace example.com/a => ../a // local
+replace example.com/b v1.0.0 => example.com/fork v1.0.1
+
+replace (
+	example.com/c => "../c d"
+	example.com/d => ./d
+)
+`
+	got := string(rewriteModPaths([]byte(gomod), false, strings.ToUpper))
+	want := `module example.com/app
+
+require example.com/other v1.2.3
+
+replace example.com/a => ../A // local
+replace example.com/b v1.0.0 => example.com/fork v1.0.1
+
+replace (
+	example.com/c => "../C D"
+	example.com/d => ./D
+)
+`
+	if got != want {
+		t.Errorf("go.mod:\n%s\nwant:\n%s", got, want)
+	}
+
+	gowork := "go 1.21\n\nuse ./app\nuse (\n\t./lib // library\n)\n"
+	got = string(rewriteModPaths([]byte(gowork), true, strings.ToUpper))
+	want = "go 1.21\n\nuse ./APP\nuse (\n\t./LIB // library\n)\n"
+	if got != want {
+		t.Errorf("go.work:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	tests := map[string]string{
+		"module example.com/app\n\ngo 1.21\n":    "example.com/app",
+		"// c\nmodule\t\"example.com/q\" // x\n": "example.com/q",
+		"modules x\n":                            "",
+		"go 1.21\n":                              "",
+	}
+	for data, want := range tests {
+		if got := ModulePath([]byte(data)); got != want {
+			t.Errorf("ModulePath(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
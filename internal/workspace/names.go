@@ -0,0 +1,240 @@
+package workspace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const namesFileName = ".pgo_names.json"
+
+// Names maps spellings that only exist in the generated workspace back to the
+// localized sources, so tool output can be reported in the original spelling.
+type Names struct {
+	// Files maps generated file base names to .p.go base names.
+	Files map[string]string `json:"files"`
+	// Idents maps generated identifiers (mangled names, test functions) to
+	// their localized spelling.
+	Idents map[string]string `json:"idents"`
+}
+
+func writeNames(genDir string, names Names) error {
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(genDir, namesFileName), data, 0o644)
+}
+
+// LoadNames reads the names recorded by the last Generate.
+func LoadNames(moduleRoot string) (Names, error) {
+	return loadNames(filepath.Join(moduleRoot, GeneratedDirName))
+}
+
+func loadNames(genDir string) (Names, error) {
+	var names Names
+	data, err := os.ReadFile(filepath.Join(genDir, namesFileName))
+	if err != nil {
+		return names, err
+	}
+	err = json.Unmarshal(data, &names)
+	return names, err
+}
+
+// Replacer rewrites generated file names and identifiers into their original
+// spelling. Longer names are tried first.
+func (n Names) Replacer() *Replacer {
+	return newReplacer(n.replacerPairs())
+}
+
+// TraceReplacer is like Replacer but also maps paths inside genDir, the
+// generated workspace, to originDir, so stack traces and compiler output
+// point at the user's files.
+func (n Names) TraceReplacer(genDir, originDir string) *Replacer {
+	pairs := append([]string{genDir, originDir}, n.replacerPairs()...)
+	return newReplacer(pairs)
+}
+
+// Replacer replaces generated names in text. Unlike a strings.Replacer it
+// only replaces whole names: TestDatos is left alone in TestDatosExtra, and a
+// path only when it does not continue another path component.
+type Replacer struct {
+	re   *regexp.Regexp // nil without names
+	news map[string]string
+}
+
+// newReplacer returns a Replacer for old, new string pairs; earlier pairs
+// win where several match at the same place.
+func newReplacer(pairs []string) *Replacer {
+	r := &Replacer{news: make(map[string]string, len(pairs)/2)}
+	var alts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if _, ok := r.news[pairs[i]]; ok || pairs[i] == "" {
+			continue
+		}
+		r.news[pairs[i]] = pairs[i+1]
+		alts = append(alts, regexp.QuoteMeta(pairs[i]))
+	}
+	if len(alts) > 0 {
+		r.re = regexp.MustCompile(strings.Join(alts, "|"))
+	}
+	return r
+}
+
+// Replace returns s with the names replaced.
+func (r *Replacer) Replace(s string) string {
+	if r.re == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for pos := 0; pos < len(s); {
+		loc := r.re.FindStringIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if !isNameBoundary(s, start, end) {
+			// A shorter name may still start inside the match.
+			_, size := utf8.DecodeRuneInString(s[start:])
+			pos = start + size
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(r.news[s[start:end]])
+		last, pos = end, end
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// WriteString writes s to w with the names replaced.
+func (r *Replacer) WriteString(w io.Writer, s string) (int, error) {
+	return io.WriteString(w, r.Replace(s))
+}
+
+// isNameBoundary reports whether s[start:end] is neither preceded nor
+// followed by a character of an identifier.
+func isNameBoundary(s string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(s[:start])
+	after, _ := utf8.DecodeRuneInString(s[end:])
+	return !isNameRune(before) && !isNameRune(after)
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mark, r)
+}
+
+func (n Names) replacerPairs() []string {
+	olds := make([]string, 0, len(n.Files)+len(n.Idents))
+	news := make(map[string]string, cap(olds))
+	for generated, original := range n.Files {
+		olds = append(olds, generated)
+		news[generated] = original
+	}
+	for generated, original := range n.Idents {
+		olds = append(olds, generated)
+		news[generated] = original
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+		return olds[i] < olds[j]
+	})
+	pairs := make([]string, 0, 2*len(olds))
+	for _, old := range olds {
+		pairs = append(pairs, old, news[old])
+	}
+	return pairs
+}
+
+// TestPattern translates a -run/-bench/-skip/-fuzz pattern written against
+// localized test names. In each alternative, the top-level element (before
+// the first '/') is matched against the original names, and the generated
+// names it selects are added as alternatives; subtest elements are never
+// rewritten. The pattern is split the way go test splits it, so '|' and '/'
+// inside brackets or parentheses do not count.
+func (n Names) TestPattern(pattern string) string {
+	alts := splitTestPattern(pattern, '|')
+	for i, alt := range alts {
+		elems := splitTestPattern(alt, '/')
+		elems[0] = n.testNamePattern(elems[0])
+		alts[i] = strings.Join(elems, "/")
+	}
+	return strings.Join(alts, "|")
+}
+
+// testNamePattern translates the top-level element of a test pattern.
+func (n Names) testNamePattern(top string) string {
+	if top == "" {
+		return top
+	}
+	re, err := regexp.Compile(top)
+	if err != nil {
+		return top
+	}
+	var matched []string
+	for generated, original := range n.Idents {
+		if isTestFuncName(generated) && re.MatchString(original) {
+			matched = append(matched, regexp.QuoteMeta(generated))
+		}
+	}
+	if len(matched) == 0 {
+		return top
+	}
+	sort.Strings(matched)
+	return "(?:^(?:" + strings.Join(matched, "|") + ")$|" + top + ")"
+}
+
+// splitTestPattern splits s at each sep outside brackets and parentheses,
+// like splitRegexp in package testing.
+func splitTestPattern(s string, sep byte) []string {
+	var parts []string
+	brackets, parens := 0, 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			brackets++
+		case ']':
+			if brackets--; brackets < 0 { // an unmatched ']' is legal
+				brackets = 0
+			}
+		case '(':
+			if brackets == 0 {
+				parens++
+			}
+		case ')':
+			if brackets == 0 {
+				parens--
+			}
+		case '\\':
+			i++
+		case sep:
+			if brackets == 0 && parens == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func isTestFuncName(name string) bool {
+	for _, prefix := range []string{"Test", "Benchmark", "Example", "Fuzz"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package workspace
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestSplitTestPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		sep     byte
+		want    []string
+	}{
+		{"", '/', []string{""}},
+		{"Prueba/sub", '/', []string{"Prueba", "sub"}},
+		{"a/b/c", '/', []string{"a", "b", "c"}},
+		{"পরীক্ষা[a/b]/x", '/', []string{"পরীক্ষা[a/b]", "x"}},
+		{"(a/b)/x", '/', []string{"(a/b)", "x"}},
+		{"[(]/x", '/', []string{"[(]", "x"}},
+		{`a\/b/x`, '/', []string{`a\/b`, "x"}},
+		{"a]/b", '/', []string{"a]", "b"}},
+		{"A/x|B/y", '|', []string{"A/x", "B/y"}},
+		{"(A|B)/x|[|]", '|', []string{"(A|B)/x", "[|]"}},
+	}
+	for _, tt := range tests {
+		if got := splitTestPattern(tt.pattern, tt.sep); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitTestPattern(%q, %q) = %q, want %q", tt.pattern, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestTestPattern(t *testing.T) {
+	names := Names{Idents: map[string]string{
+		"TestSuma":      "পরীক্ষাযোগ",
+		"TestResta":     "পরীক্ষাবিয়োগ",
+		"BenchmarkSuma": "বেঞ্চমার্কযোগ",
+		"helper_x":      "পরীক্ষাসাহায্য",
+		"TestOtro":      "অন্য",
+	}}
+	tests := map[string]string{
+		"":               "",
+		"TestSuma":       "TestSuma",
+		"পরীক্ষাযোগ":     "(?:^(?:TestSuma)$|পরীক্ষাযোগ)",
+		"^পরীক্ষা":       "(?:^(?:TestResta|TestSuma)$|^পরীক্ষা)",
+		"পরীক্ষাযোগ/ক/খ": "(?:^(?:TestSuma)$|পরীক্ষাযোগ)/ক/খ",
+		"পরীক্ষা[যব]/ক":  "(?:^(?:TestResta|TestSuma)$|পরীক্ষা[যব])/ক",
+		"পরীক্ষাযোগ|বেঞ্চমার্ক/ক": "(?:^(?:TestSuma)$|পরীক্ষাযোগ)|(?:^(?:BenchmarkSuma)$|বেঞ্চমার্ক)/ক",
+		"(পরীক্ষাযোগ|অন্য)/ক":     "(?:^(?:TestOtro|TestSuma)$|(পরীক্ষাযোগ|অন্য))/ক",
+		"পরীক্ষা(":                "পরীক্ষা(",
+		"/ক":                      "/ক",
+	}
+	for pattern, want := range tests {
+		if got := names.TestPattern(pattern); got != want {
+			t.Errorf("TestPattern(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+
+	// Go matches each element of the translated pattern on its own; the
+	// subtest element must still be applied to the generated test.
+	elems := splitTestPattern(names.TestPattern("পরীক্ষা[যব]/ক"), '/')
+	if len(elems) != 2 {
+		t.Fatalf("elements %q", elems)
+	}
+	if re := regexp.MustCompile(elems[0]); !re.MatchString("TestSuma") || re.MatchString("TestSumaX") {
+		t.Errorf("top-level element %q", elems[0])
+	}
+}
+
+func TestReplacer(t *testing.T) {
+	names := Names{
+		Files:  map[string]string{"datos_test_p.go": "datos_test.p.go"},
+		Idents: map[string]string{"TestDatos": "PruebaDatos", "Bgo_5Ywg": "যোগ", "T": "ট"},
+	}
+	tests := map[string]string{
+		"--- FAIL: TestDatos (0.00s)":         "--- FAIL: PruebaDatos (0.00s)",
+		"--- FAIL: TestDatosExtra (0.00s)":    "--- FAIL: TestDatosExtra (0.00s)",
+		"--- FAIL: TestDatos/sub (0.00s)":     "--- FAIL: PruebaDatos/sub (0.00s)",
+		"main.Bgo_5Ywg()":                     "main.যোগ()",
+		"main.Bgo_5Ywg2()":                    "main.Bgo_5Ywg2()",
+		"x.T T Tx":                            "x.ট ট Tx",
+		"\tdatos_test_p.go:12: ok":            "\tdatos_test.p.go:12: ok",
+		"\tmydatos_test_p.go:12: ok":          "\tmydatos_test_p.go:12: ok",
+		"/src/app/.pgo_gen/datos_test_p.go:3": "/src/app/datos_test.p.go:3",
+		"/src/app/.pgo_gen2/x.go":             "/src/app/.pgo_gen2/x.go",
+		"prefix/src/app/.pgo_gen/x.go":        "prefix/src/app/.pgo_gen/x.go",
+	}
+	r := names.TraceReplacer("/src/app/.pgo_gen", "/src/app")
+	for in, want := range tests {
+		if got := r.Replace(in); got != want {
+			t.Errorf("Replace(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := (Names{}).Replacer().Replace("TestDatos"); got != "TestDatos" {
+		t.Errorf("empty Replacer changed %q", got)
+	}
+}
@@ -0,0 +1,107 @@
+package workspace
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/newmizanur/poly-go/internal/transpile"
+)
+
+const sourceMapFileName = ".pgo_sourcemap.json"
+
+// SourceMap records, for every Go file transpiled from a .p.go source, the
+// spans where the two differ. Lines map one to one; columns are bytes.
+type SourceMap struct {
+	Version int `json:"version"`
+	// Files is keyed by the slash-separated path of the generated file,
+	// relative to the workspace.
+	Files map[string]FileMap `json:"files"`
+}
+
+// FileMap is the source map of one generated file.
+type FileMap struct {
+	// Source is the slash-separated path of the .p.go file, relative to the
+	// module root.
+	Source string           `json:"source"`
+	Spans  []transpile.Span `json:"spans"`
+}
+
+func newSourceMap() SourceMap {
+	return SourceMap{Version: 1, Files: make(map[string]FileMap)}
+}
+
+func writeSourceMap(genDir string, m SourceMap) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(genDir, sourceMapFileName), data, 0o644)
+}
+
+// LoadSourceMap reads the source map written by the last Generate.
+func LoadSourceMap(moduleRoot string) (SourceMap, error) {
+	var m SourceMap
+	data, err := os.ReadFile(filepath.Join(moduleRoot, GeneratedDirName, sourceMapFileName))
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// Original maps a line and column of a generated file (slash path relative
+// to the workspace) to its source file and column. ok is false for files
+// that were not transpiled.
+func (m SourceMap) Original(file string, line, column int) (source string, srcColumn int, ok bool) {
+	fm, ok := m.Files[file]
+	if !ok {
+		return file, column, false
+	}
+	return fm.Source, mapColumn(fm.Spans, line, column, false, false), true
+}
+
+// Generated is the inverse of Original: it maps a line and column of a
+// .p.go source (slash path relative to the module root) into the generated
+// file.
+func (m SourceMap) Generated(source string, line, column int) (file string, genColumn int, ok bool) {
+	files := make([]string, 0, len(m.Files))
+	for file, fm := range m.Files {
+		if fm.Source == source {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return source, column, false
+	}
+	sort.Strings(files)
+	return files[0], mapColumn(m.Files[files[0]].Spans, line, column, true, false), true
+}
+
+// mapColumn maps a column through the spans of a file. A column inside a
+// replaced span maps to the start of the other side of the span, or to its
+// end when column is an exclusive end position.
+func mapColumn(spans []transpile.Span, line, column int, fromSource, end bool) int {
+	delta := 0
+	for _, span := range spans {
+		if span.Line != line {
+			continue
+		}
+		from, fromLen, to, toLen := span.GenColumn, span.GenLength, span.SrcColumn, span.SrcLength
+		if fromSource {
+			from, fromLen, to, toLen = to, toLen, from, fromLen
+		}
+		if column < from || end && column == from {
+			break
+		}
+		if column < from+fromLen {
+			if end {
+				return to + toLen
+			}
+			return to
+		}
+		delta += toLen - fromLen
+	}
+	return column + delta
+}
@@ -0,0 +1,168 @@
+package workspace
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Snapshot records the files of a generated workspace, so that files go
+// commands write into it (go generate, go mod tidy) can be copied back to the
+// module with SyncBack.
+type Snapshot struct {
+	files map[string]fileState
+}
+
+// TakeSnapshot records the current files of the workspace of moduleRoot.
+func TakeSnapshot(moduleRoot string) (Snapshot, error) {
+	genDir := filepath.Join(moduleRoot, GeneratedDirName)
+	snap := Snapshot{files: make(map[string]fileState)}
+	err := filepath.WalkDir(genDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(genDir, path)
+		if err != nil {
+			return err
+		}
+		snap.files[rel] = fileState{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return snap, err
+}
+
+// SyncBack copies the files of the workspace that are new or changed since
+// before into the module, and returns their paths relative to moduleRoot.
+// Files transpiled from .p.go sources are not copied; changing them is an
+// error, since the change would be lost on the next Generate.
+func SyncBack(moduleRoot string, before Snapshot) ([]string, error) {
+	genDir := filepath.Join(moduleRoot, GeneratedDirName)
+	sm, err := LoadSourceMap(moduleRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	modPaths, err := loadModPaths(genDir)
+	if err != nil {
+		return nil, err
+	}
+	replaced := make(map[string]bool)
+	for _, name := range []string{"go.work", "go.mod"} {
+		if data, err := os.ReadFile(filepath.Join(genDir, name)); err == nil {
+			for m := range dependencyReplaces(data) {
+				replaced[m] = true
+			}
+		}
+	}
+	var copied, clobbered []string
+	err = filepath.WalkDir(genDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(genDir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// Generated copies of external modules have no place in the
+			// module; their sources live elsewhere.
+			if rel == externalModulesDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if rel == namesFileName || rel == sourceMapFileName || rel == modPathsFileName {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if old, ok := before.files[rel]; ok && old.size == info.Size() && old.modTime.Equal(info.ModTime()) {
+			return nil
+		}
+		// go mod vendor owns the vendor directory, transpiled files included.
+		if fm, ok := sm.Files[filepath.ToSlash(rel)]; ok && !strings.HasPrefix(filepath.ToSlash(rel)+"/", "vendor/") && !strings.Contains(filepath.ToSlash(rel), "/vendor/") {
+			clobbered = append(clobbered, fmt.Sprintf("%s (generated from %s)", rel, fm.Source))
+			return nil
+		}
+		dest := filepath.Join(moduleRoot, rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return err
+		}
+		if d.Name() == "go.mod" || d.Name() == "go.work" {
+			// Drop the replaces of transpiled dependencies and put back
+			// the paths Generate rewrote.
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			data = stripDependencyReplaces(data)
+			if rewritten, ok := modPaths[filepath.ToSlash(rel)]; ok {
+				data = rewriteModPaths(data, d.Name() == "go.work", func(p string) string {
+					if original, ok := rewritten[p]; ok {
+						return original
+					}
+					return p
+				})
+			}
+			if err := os.WriteFile(dest, data, 0o644); err != nil {
+				return err
+			}
+		} else if d.Name() == "modules.txt" && filepath.Base(filepath.Dir(rel)) == "vendor" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(dest, stripVendorReplacements(data, replaced), 0o644); err != nil {
+				return err
+			}
+		} else if d.Name() == "go.sum" || d.Name() == "go.work.sum" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			old, err := os.ReadFile(dest)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err := os.WriteFile(dest, keepDependencySums(data, old, replaced), 0o644); err != nil {
+				return err
+			}
+		} else if err := copyFile(path, dest); err != nil {
+			return err
+		}
+		copied = append(copied, rel)
+		return nil
+	})
+	if err != nil {
+		return copied, err
+	}
+	// A new modules.txt means go mod vendor rewrote the vendor directory.
+	for _, rel := range copied {
+		if filepath.Base(rel) == "modules.txt" && filepath.Base(filepath.Dir(rel)) == "vendor" {
+			vendorRel := filepath.Dir(rel)
+			if err := removeStaleVendorFiles(filepath.Join(moduleRoot, vendorRel), filepath.Join(genDir, vendorRel)); err != nil {
+				return copied, err
+			}
+		}
+	}
+	sort.Strings(copied)
+	if len(clobbered) > 0 {
+		sort.Strings(clobbered)
+		return copied, fmt.Errorf("transpiled files were modified in %s; change the .p.go sources instead: %s", GeneratedDirName, strings.Join(clobbered, ", "))
+	}
+	return copied, nil
+}
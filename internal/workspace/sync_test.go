@@ -0,0 +1,110 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncBack(t *testing.T) {
+	root := t.TempDir()
+	genDir := filepath.Join(root, GeneratedDirName)
+	libDir := filepath.Join(genDir, externalModulesDir, "lib-1234")
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// touch makes sure a rewrite is seen even on file systems with coarse
+	// modification times.
+	touch := func(path string) {
+		t.Helper()
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The workspace as Generate leaves it: ../lib rewritten to its
+	// generated copy, and a transpiled dependency replaced.
+	userMod := "module example.com/app\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ../lib\n"
+	write(filepath.Join(root, "go.mod"), userMod)
+	write(filepath.Join(root, "go.sum"), "example.com/greet v1.0.0 h1:aaa=\nexample.com/greet v1.0.0/go.mod h1:bbb=\n")
+	write(filepath.Join(root, "keep.txt"), "mine\n")
+	genMod := strings.Replace(userMod, "../lib", libDir, 1)
+	write(filepath.Join(genDir, "go.mod"), string(appendDependencyReplaces([]byte(genMod), []string{
+		"example.com/greet v1.0.0 => /cache/example.com/greet@v1.0.0-abc",
+	})))
+	write(filepath.Join(genDir, "keep.txt"), "mine\n")
+	write(filepath.Join(genDir, "main_p.go"), "package main\n")
+	write(filepath.Join(libDir, "lib_p.go"), "package lib\n")
+	if err := writeModPaths(genDir, map[string]map[string]string{"go.mod": {libDir: "../lib"}}); err != nil {
+		t.Fatal(err)
+	}
+	sm := newSourceMap()
+	sm.Files["main_p.go"] = FileMap{Source: "main.p.go"}
+	if err := writeSourceMap(genDir, sm); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := TakeSnapshot(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What go mod tidy and go generate might do.
+	tidied := strings.Replace(genMod, "require example.com/lib v0.0.0", "require (\n\texample.com/lib v0.0.0\n\texample.com/greet v1.0.0\n)", 1)
+	write(filepath.Join(genDir, "go.mod"), string(appendDependencyReplaces([]byte(tidied), []string{
+		"example.com/greet v1.0.0 => /cache/example.com/greet@v1.0.0-abc",
+	})))
+	write(filepath.Join(genDir, "go.sum"), "example.com/other v0.2.0 h1:eee=\n")
+	write(filepath.Join(genDir, "gen", "table.txt"), "generated\n")
+	write(filepath.Join(libDir, "new.txt"), "not copied\n")
+	for _, rel := range []string{"go.mod", "go.sum", filepath.Join("gen", "table.txt"), filepath.Join(externalModulesDir, "lib-1234", "new.txt")} {
+		touch(filepath.Join(genDir, rel))
+	}
+
+	copied, err := SyncBack(root, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join("gen", "table.txt"), "go.mod", "go.sum"}; !reflect.DeepEqual(copied, want) {
+		t.Errorf("copied %q, want %q", copied, want)
+	}
+	gotMod, _ := os.ReadFile(filepath.Join(root, "go.mod"))
+	if want := strings.Replace(tidied, libDir, "../lib", 1); string(gotMod) != want {
+		t.Errorf("go.mod:\n%s\nwant:\n%s", gotMod, want)
+	}
+	gotSum, _ := os.ReadFile(filepath.Join(root, "go.sum"))
+	if want := "example.com/greet v1.0.0 h1:aaa=\nexample.com/greet v1.0.0/go.mod h1:bbb=\nexample.com/other v0.2.0 h1:eee=\n"; string(gotSum) != want {
+		t.Errorf("go.sum:\n%s\nwant:\n%s", gotSum, want)
+	}
+	if _, err := os.Stat(filepath.Join(root, externalModulesDir)); !os.IsNotExist(err) {
+		t.Errorf("generated external module copied back: %v", err)
+	}
+
+	// Edits to transpiled files would be lost; they are reported.
+	before, err = TakeSnapshot(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(filepath.Join(genDir, "main_p.go"), "package main // edited\n")
+	touch(filepath.Join(genDir, "main_p.go"))
+	copied, err = SyncBack(root, before)
+	if err == nil || !strings.Contains(err.Error(), "main_p.go (generated from main.p.go)") {
+		t.Errorf("SyncBack after editing a transpiled file: %v", err)
+	}
+	if len(copied) != 0 {
+		t.Errorf("copied %q after editing a transpiled file", copied)
+	}
+	if _, err := os.Stat(filepath.Join(root, "main_p.go")); !os.IsNotExist(err) {
+		t.Errorf("transpiled file copied back: %v", err)
+	}
+}
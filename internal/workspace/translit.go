@@ -0,0 +1,134 @@
+package workspace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/newmizanur/poly-go/internal/transpile"
+)
+
+// TranslitFileName is the file at the root that keeps the Latin names of
+// transliterated identifiers (see Config.Transliterate) between runs, so
+// they stay stable and can be mapped back. It belongs under version control.
+const TranslitFileName = ".pgo_translit.json"
+
+type translitFile struct {
+	// Names maps identifiers of the sources to their Latin names.
+	Names map[string]string `json:"names"`
+	// Dependencies holds the names exported by dependencies, which the
+	// sources must use as well (see Transliterator.Adopt).
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// WithTransliteration returns maps with a Transliterator that starts from the
+// root's TranslitFileName, when transliteration is enabled by opts or the
+// root's pgo.json; otherwise maps is returned unchanged.
+func WithTransliteration(root string, maps transpile.Maps, opts Options) (transpile.Maps, error) {
+	tr, err := loadTransliterator(root, maps, opts)
+	if err != nil || tr == nil {
+		return maps, err
+	}
+	maps.Transliterator = tr
+	return maps, nil
+}
+
+func loadTransliterator(root string, maps transpile.Maps, opts Options) (*transpile.Transliterator, error) {
+	if !opts.Transliterate {
+		cfg, err := LoadConfig(root)
+		if err != nil || !cfg.Transliterate {
+			return nil, err
+		}
+	}
+	saved, err := loadTranslitFile(root)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := transpile.NewTransliterator(maps, saved.Names)
+	if err != nil {
+		return nil, fmt.Errorf("transliteration: %w", err)
+	}
+	tr.Adopt(saved.Dependencies)
+	return tr, nil
+}
+
+// loadTranslitFile reads the TranslitFileName of dir. A missing file yields
+// no names.
+func loadTranslitFile(dir string) (translitFile, error) {
+	var saved translitFile
+	path := filepath.Join(dir, TranslitFileName)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return saved, fmt.Errorf("%s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return saved, err
+	}
+	return saved, nil
+}
+
+// exportedNames returns the names whose Latin form is exported, the only ones
+// other packages can refer to.
+func exportedNames(names map[string]string) map[string]string {
+	exported := make(map[string]string)
+	for original, latin := range names {
+		if latin != "" && latin[0] >= 'A' && latin[0] <= 'Z' {
+			exported[original] = latin
+		}
+	}
+	return exported
+}
+
+// saveTransliterator writes the names of tr to the root's TranslitFileName
+// if they changed.
+func saveTransliterator(root string, tr *transpile.Transliterator) error {
+	if tr == nil || !tr.Changed() {
+		return nil
+	}
+	data, err := json.MarshalIndent(translitFile{Names: tr.Names(), Dependencies: tr.Adopted()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	path := filepath.Join(root, TranslitFileName)
+	// Adopting the saved dependency names counts as a change.
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// reserveNames keeps the ASCII identifiers of the Go and .p.go sources below
+// dir from being given to transliterated ones. Outputs of GenerateInPlace
+// hold transliterated names themselves and are skipped.
+func reserveNames(tr *transpile.Transliterator, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != dir && (name == GeneratedDirName || name == "vendor" || strings.HasPrefix(name, ".")) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(name) != ".go" || isInPlaceOutput(path) {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, ident := range transpile.ASCIIIdents(src) {
+			tr.Reserve(ident)
+		}
+		return nil
+	})
+}
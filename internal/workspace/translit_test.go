@@ -0,0 +1,71 @@
+package workspace
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readTranslitFile(t *testing.T, root string) translitFile {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, TranslitFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved translitFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	return saved
+}
+
+func TestTransliterationFile(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"go.mod":    "module ex\n\ngo 1.21\n",
+		"pgo.json":  `{"transliterate": true}`,
+		"main.p.go": "প্যাকেজ main\n\nফাংশন যোগফল() {}\n\nফাংশন main() { যোগফল() }\n",
+		// The name যোগফল would get is taken.
+		"other.go": "package main\n\nvar Jogafal = 1\n",
+	})
+	maps := loadMaps(t, "bn")
+	generated := func() string {
+		t.Helper()
+		if err := Generate(root, maps, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		out, err := os.ReadFile(filepath.Join(root, GeneratedDirName, "main_p.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	if out := generated(); !strings.Contains(out, "func Jogafal_2()") {
+		t.Errorf("main_p.go:\n%s", out)
+	}
+	if saved := readTranslitFile(t, root); !reflect.DeepEqual(saved.Names, map[string]string{"যোগফল": "Jogafal_2"}) {
+		t.Errorf("saved names %v", saved.Names)
+	}
+
+	// Saved names are used as they are.
+	writeTree(t, root, map[string]string{TranslitFileName: "{\n  \"names\": {\n    \"যোগফল\": \"Sum\"\n  }\n}\n"})
+	if out := generated(); !strings.Contains(out, "func Sum()") {
+		t.Errorf("main_p.go with a saved name:\n%s", out)
+	}
+	if saved := readTranslitFile(t, root); saved.Names["যোগফল"] != "Sum" {
+		t.Errorf("saved names %v", saved.Names)
+	}
+
+	// A saved name that an ASCII identifier took since is given up.
+	writeTree(t, root, map[string]string{"other.go": "package main\n\nvar Sum = 1\n"})
+	if out := generated(); strings.Contains(out, "func Sum()") {
+		t.Errorf("main_p.go kept a reserved name:\n%s", out)
+	}
+	if saved := readTranslitFile(t, root); saved.Names["যোগফল"] == "Sum" {
+		t.Errorf("saved names %v", saved.Names)
+	}
+}
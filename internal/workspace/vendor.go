@@ -0,0 +1,156 @@
+package workspace
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The vendor directory of a module (or of a go.work file, see go work
+// vendor) is mirrored into the workspace with modules.txt untouched. Without
+// .p.go files it is only linked. Vendored .p.go files are transpiled with the
+// root's map, since the .pgo_lang of their module is not vendored; when the
+// module was published with GenerateInPlace, the vendored output is used
+// instead.
+
+// isVendorDir reports whether dir is the vendor directory of a module or
+// workspace root, the only place the go command looks for one.
+func isVendorDir(dir string) bool {
+	if filepath.Base(dir) != "vendor" {
+		return false
+	}
+	parent := filepath.Dir(dir)
+	for _, name := range []string{"go.mod", "go.work"} {
+		if _, err := os.Stat(filepath.Join(parent, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// generateVendor mirrors the vendor directory src of tree t into dest.
+func (g *generator) generateVendor(t *tree, src, dest string) error {
+	if !containsPGoFiles(src) {
+		if err := os.Symlink(src, dest); err == nil {
+			return nil
+		}
+		// Symbolic links may need privileges (Windows); copy instead.
+	}
+	return g.generateTree(&tree{src: src, dest: dest, maps: t.maps, external: true, vendor: true})
+}
+
+func containsPGoFiles(dir string) bool {
+	found := false
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, ".p.go") {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found
+}
+
+// hasInPlaceOutput reports whether the .p.go file at path has an output of
+// GenerateInPlace next to it.
+func hasInPlaceOutput(path, goName string) bool {
+	return isInPlaceOutput(filepath.Join(filepath.Dir(path), goName))
+}
+
+// vendorMode reports whether the go command will build the module or
+// workspace at dir from its vendor directory, given the value of its -mod
+// flag (empty if unset).
+func vendorMode(dir, modFlag string) bool {
+	switch modFlag {
+	case "vendor":
+		return true
+	case "mod", "readonly":
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vendor", "modules.txt")); err != nil {
+		return false
+	}
+	// Vendoring is the default from go 1.14 on, for go.work files from
+	// go 1.22, when they got vendor directories.
+	name, minor := "go.work", 22
+	if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+		name, minor = "go.mod", 14
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return false
+	}
+	return goVersionAtLeast(data, minor)
+}
+
+// goVersionAtLeast reports whether the go directive of a go.mod or go.work
+// file names go 1.minor or later.
+func goVersionAtLeast(data []byte, minor int) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "go" {
+			continue
+		}
+		major, rest, _ := strings.Cut(fields[1], ".")
+		// Pre-releases: 1.21rc1 counts as 1.21.
+		end := 0
+		for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+			end++
+		}
+		m, err := strconv.Atoi(rest[:end])
+		return major != "1" || (err == nil && m >= minor)
+	}
+	return false
+}
+
+// stripVendorReplacements removes the replacements of transpiled
+// dependencies from a vendor/modules.txt written in the workspace, so it
+// matches the module's own go.mod again.
+func stripVendorReplacements(data []byte, replaced map[string]bool) []byte {
+	if len(replaced) == 0 {
+		return data
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "#" || fields[3] != "=>" || !replaced[fields[1]+" "+fields[2]] {
+			continue
+		}
+		idx := strings.Index(line, " =>")
+		lines[i] = line[:idx] + lineEnding(line)
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// removeStaleVendorFiles deletes the files of the module's vendor directory
+// that the workspace's copy no longer has, as go mod vendor does.
+func removeStaleVendorFiles(vendorDir, genVendorDir string) error {
+	var dirs []string
+	err := filepath.WalkDir(vendorDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(vendorDir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if _, err := os.Lstat(filepath.Join(genVendorDir, rel)); os.IsNotExist(err) {
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Innermost first; Remove fails on directories that still have files.
+	for i := len(dirs) - 1; i > 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return nil
+}
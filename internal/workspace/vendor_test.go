@@ -0,0 +1,42 @@
+package workspace
+
+import "testing"
+
+func TestStripVendorReplacements(t *testing.T) {
+	modulesTxt := "# example.com/greet v1.0.0 => /cache/pgo/mod/example.com/greet@v1.0.0-abc\n" +
+		"## explicit; go 1.21\n" +
+		"example.com/greet\n" +
+		"# example.com/local v0.0.0 => ../local\n" +
+		"example.com/local\n"
+	replaced := map[string]bool{"example.com/greet v1.0.0": true}
+
+	got := string(stripVendorReplacements([]byte(modulesTxt), replaced))
+	want := "# example.com/greet v1.0.0\n" +
+		"## explicit; go 1.21\n" +
+		"example.com/greet\n" +
+		"# example.com/local v0.0.0 => ../local\n" +
+		"example.com/local\n"
+	if got != want {
+		t.Fatalf("stripVendorReplacements:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGoVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		gomod string
+		minor int
+		want  bool
+	}{
+		{"module x\n\ngo 1.21\n", 14, true},
+		{"module x\n\ngo 1.13\n", 14, false},
+		{"module x\n\ngo 1.22.1\n", 22, true},
+		{"go 1.21rc1\n", 21, true},
+		{"go 1.21rc1\n", 22, false},
+		{"module x\n", 14, false},
+	}
+	for _, tt := range tests {
+		if got := goVersionAtLeast([]byte(tt.gomod), tt.minor); got != tt.want {
+			t.Errorf("goVersionAtLeast(%q, %d) = %v, want %v", tt.gomod, tt.minor, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package workspace
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/fs"
@@ -27,86 +30,478 @@ func FindModuleRoot(start string) (string, error) {
 	}
 }
 
-func Generate(moduleRoot string, maps transpile.Maps, locale string) error {
+// Options control workspace generation.
+type Options struct {
+	// Locale limits localized examples and testdata to one locale; empty
+	// includes all of them.
+	Locale string
+	// LineDirectives makes transpiled files start with a /*line*/ directive
+	// naming their .p.go source, so debug info and stack traces refer to the
+	// localized files. Used for debug builds.
+	LineDirectives bool
+	// ModuleMaps returns the keyword map of a module outside the root when
+	// that module declares its own; otherwise (ok == false) the root's map is
+	// used. May be nil.
+	ModuleMaps func(moduleDir string) (maps transpile.Maps, ok bool, err error)
+	// Warn receives problems in modules outside the root that do not stop
+	// generation: .p.go files there that fail to transpile are skipped, so
+	// packages the root never imports cannot break its build. May be nil.
+	Warn func(err error)
+	// ModFlag is the -mod flag the go command will run with, if any. It
+	// decides whether dependencies come from the vendor directory.
+	ModFlag string
+	// Exclude and Include add to the exclude and include patterns of the
+	// root's pgo.json (see Config).
+	Exclude, Include []string
+	// CacheDir holds the transpiled copies of dependencies with .p.go
+	// sources; empty means pgo/mod in the user cache directory.
+	CacheDir string
+	// KeywordCheck overrides the keyword_check of the root's pgo.json.
+	KeywordCheck CheckMode
+	// Transliterate gives non-ASCII identifiers Latin names from the
+	// transliteration table of the keyword map, as the transliterate setting
+	// of the root's pgo.json does. The names are kept in TranslitFileName.
+	Transliterate bool
+}
+
+// CheckMode says what Generate does with .go files that use localized
+// keywords, which usually means a .p.go file was misnamed.
+type CheckMode string
+
+const (
+	// CheckError stops generation; it is the default.
+	CheckError CheckMode = "error"
+	// CheckWarn reports the file through Options.Warn and copies it.
+	CheckWarn CheckMode = "warn"
+	// CheckOff skips the check.
+	CheckOff CheckMode = "off"
+)
+
+// ParseCheckMode validates a CheckMode given by name.
+func ParseCheckMode(s string) (CheckMode, error) {
+	switch mode := CheckMode(s); mode {
+	case CheckError, CheckWarn, CheckOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid keyword check %q; want error, warn or off", s)
+}
+
+// Generate recreates the generated workspace of root, a module root or the
+// directory of a go.work file (see FindRoot). The tree below root is
+// mirrored, so nested modules and relative go.mod/go.work paths within it
+// keep working. Modules outside root that are referenced by relative or
+// absolute paths are generated into externalModulesDir when they contain .p.go
+// files, and referenced by absolute path otherwise. Dependencies from the
+// module cache with .p.go files are replaced by transpiled copies in
+// opts.CacheDir.
+//
+// With transliteration, the root takes over the Latin names its dependencies
+// export. When it used other names for them, the workspace is generated a
+// second time with the adopted names.
+func Generate(moduleRoot string, maps transpile.Maps, opts Options) error {
+	stale, err := generate(moduleRoot, maps, opts)
+	if err == nil && stale {
+		_, err = generate(moduleRoot, maps, opts)
+	}
+	return err
+}
+
+// generate generates the workspace once and reports whether the names of
+// transliterated identifiers changed while doing so.
+func generate(moduleRoot string, maps transpile.Maps, opts Options) (bool, error) {
 	genDir := filepath.Join(moduleRoot, GeneratedDirName)
 	if err := os.RemoveAll(genDir); err != nil {
-		return err
+		return false, err
 	}
 	if err := os.MkdirAll(genDir, 0o755); err != nil {
-		return err
+		return false, err
+	}
+	keywordCheck, err := resolveKeywordCheck(moduleRoot, opts)
+	if err != nil {
+		return false, err
+	}
+	translit, err := loadTransliterator(moduleRoot, maps, opts)
+	if err != nil {
+		return false, err
 	}
 
-	if err := copyIfExists(filepath.Join(moduleRoot, "go.mod"), filepath.Join(genDir, "go.mod")); err != nil {
-		return err
+	g := &generator{
+		root:         moduleRoot,
+		genDir:       genDir,
+		maps:         maps,
+		opts:         opts,
+		keywordCheck: keywordCheck,
+		translit:     translit,
+		names:        Names{Files: make(map[string]string), Idents: make(map[string]string)},
+		sourceMap:    newSourceMap(),
+		trees:        make(map[string]*tree),
+		modPaths:     make(map[string]map[string]string),
 	}
-	if err := copyIfExists(filepath.Join(moduleRoot, "go.sum"), filepath.Join(genDir, "go.sum")); err != nil {
-		return err
+	root := &tree{src: moduleRoot, dest: genDir, maps: g.treeMaps(maps)}
+	g.trees[moduleRoot] = root
+	if err := g.generateTree(root); err != nil {
+		return false, err
+	}
+	if err := g.replaceDependencies(); err != nil {
+		return false, err
+	}
+	if err := writeSourceMap(genDir, g.sourceMap); err != nil {
+		return false, err
+	}
+	if err := writeModPaths(genDir, g.modPaths); err != nil {
+		return false, err
 	}
+	if err := saveTransliterator(moduleRoot, translit); err != nil {
+		return false, err
+	}
+	return g.staleNames, writeNames(genDir, g.names)
+}
 
-	return filepath.WalkDir(moduleRoot, func(path string, d fs.DirEntry, err error) error {
+// externalModulesDir holds the generated copies of modules outside the root
+// that contain .p.go files. The underscore keeps it out of ./... patterns.
+const externalModulesDir = "_modules"
+
+type generator struct {
+	root   string
+	genDir string
+	maps   transpile.Maps
+	opts   Options
+	// keywordCheck is the resolved Options.KeywordCheck.
+	keywordCheck CheckMode
+	// translit is shared by the root and the modules generated with it, so
+	// their names stay unique; nil unless transliteration is enabled.
+	translit *transpile.Transliterator
+	// staleNames is set when translit adopted the name of a dependency that
+	// differs from one already used.
+	staleNames bool
+	names      Names
+	sourceMap  SourceMap
+	// trees holds every source tree being generated, by source directory.
+	trees map[string]*tree
+	// modPaths records the paths rewritten in generated go.mod and go.work
+	// files: file (relative to genDir) → new path → path as written.
+	modPaths map[string]map[string]string
+}
+
+// tree is a source tree mirrored into the workspace: the root, or a module
+// outside it.
+type tree struct {
+	src, dest string
+	maps      transpile.Maps
+	external  bool
+	vendor    bool
+}
+
+// generateTree mirrors t.src into t.dest, transpiling .p.go files.
+func (g *generator) generateTree(t *tree) error {
+	srcRoot, destRoot := t.src, t.dest
+	filter, err := newTreeFilter(srcRoot, g.opts)
+	if err != nil {
+		return err
+	}
+	if tr := t.maps.Transliterator; tr != nil {
+		if err := reserveNames(tr, srcRoot); err != nil {
+			return err
+		}
+	}
+	var embeds []string
+	err = filepath.WalkDir(srcRoot, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if path == moduleRoot {
-			return nil
+		if path == srcRoot {
+			return filter.enterDir(path)
 		}
 
 		name := d.Name()
 		if d.IsDir() {
+			if name == "vendor" && !t.external && isVendorDir(path) {
+				rel, err := filepath.Rel(srcRoot, path)
+				if err != nil {
+					return err
+				}
+				if err := g.generateVendor(t, path, filepath.Join(destRoot, rel)); err != nil {
+					return err
+				}
+				return fs.SkipDir
+			}
 			if name == GeneratedDirName || name == ".git" || name == "vendor" {
 				return fs.SkipDir
 			}
+			// Outside the root only what the go command builds matters.
+			if t.external && (name == "testdata" || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")) {
+				return fs.SkipDir
+			}
+			return filter.enterDir(path)
+		}
+		if filter.skip(path, false) {
+			return nil
+		}
+		// Embed targets among them are copied after the walk.
+		if t.external && (strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")) {
 			return nil
 		}
 
-		rel, err := filepath.Rel(moduleRoot, path)
+		rel, err := filepath.Rel(srcRoot, path)
 		if err != nil {
 			return err
 		}
-		dest := filepath.Join(genDir, rel)
-
-		if filepath.Base(path) == "go.mod" || filepath.Base(path) == "go.sum" {
-			return nil
+		// Sources are named relative to the root in errors and maps; files
+		// of external modules start with "..".
+		rootRel, err := filepath.Rel(g.root, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(destRoot, rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return err
 		}
 
-		if strings.HasSuffix(path, ".p.go") {
-			if !shouldIncludeLocalized(rel, locale) {
+		switch {
+		case name == "go.mod" || name == "go.work":
+			return g.copyModFile(path, dest, name == "go.work")
+
+		case strings.HasSuffix(path, ".p.go"):
+			if !shouldIncludeLocalized(rel, g.opts.Locale) {
+				return nil
+			}
+			if t.vendor && hasInPlaceOutput(path, transpile.GoFileName(name, t.maps)) {
 				return nil
 			}
 			src, err := os.ReadFile(path)
 			if err != nil {
 				return err
 			}
-			out, err := transpile.TranspileFileLocalizedToGo(rel, src, maps)
+			out, err := transpile.TranspileFileLocalizedToGo(rootRel, src, t.maps)
+			if err == nil {
+				var targets []string
+				targets, err = checkEmbedPatterns(path, rootRel, out)
+				embeds = append(embeds, targets...)
+			}
 			if err != nil {
+				if t.external {
+					g.warn(fmt.Errorf("skipping %s: %w", path, err))
+					return nil
+				}
 				return err
 			}
-			outPath := filepath.Join(genDir, bgToGoOutput(rel))
-			if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+			out = assumePublishTag(out)
+			outPath := filepath.Join(destRoot, transpile.GoFileName(rel, t.maps))
+			genRel, err := filepath.Rel(g.genDir, outPath)
+			if err != nil {
 				return err
 			}
+			if g.opts.LineDirectives {
+				out = transpile.AddLineDirective(out, path)
+			}
+			g.names.Files[filepath.Base(outPath)] = filepath.Base(rel)
+			g.sourceMap.Files[filepath.ToSlash(genRel)] = FileMap{
+				Source: filepath.ToSlash(rootRel),
+				Spans:  transpile.ReplacedSpans(src, out),
+			}
+			for generated, original := range transpile.GeneratedNames(rootRel, src, t.maps) {
+				g.names.Idents[generated] = original
+			}
 			return os.WriteFile(outPath, out, 0o644)
-		}
 
-		if filepath.Ext(path) == ".go" {
+		case filepath.Ext(path) == ".go":
 			src, err := os.ReadFile(path)
 			if err != nil {
 				return err
 			}
-			if transpile.ContainsLocalizedKeywords(src, maps) {
-				return fmt.Errorf("localized keywords found in %s; rename file to *.p.go so it can be transpiled", rel)
+			// Outputs of GenerateInPlace are replaced by fresh translations,
+			// except in vendor directories (see generateVendor).
+			if !t.vendor && bytes.HasPrefix(src, []byte(inPlaceHeader)) {
+				return nil
 			}
-			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			if !t.external {
+				if err := g.checkLocalizedKeywords(rootRel, src, t.maps); err != nil {
+					return err
+				}
+			}
+			targets, err := checkEmbedPatterns(path, rootRel, src)
+			if err != nil {
 				return err
 			}
+			embeds = append(embeds, targets...)
 			return copyFile(path, dest)
 		}
+		return copyFile(path, dest)
+	})
+	if err != nil {
+		return err
+	}
+	return copyEmbedTargets(srcRoot, destRoot, embeds)
+}
 
-		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+// copyModFile copies a go.mod or go.work file, pointing paths that leave
+// the mirrored trees at generated or original modules.
+func (g *generator) copyModFile(path, dest string, isWork bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dir, destDir := filepath.Dir(path), filepath.Dir(dest)
+	rewritten := make(map[string]string)
+	var resolveErr error
+	data = rewriteModPaths(data, isWork, func(written string) string {
+		abs := written
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(dir, abs)
+		}
+		target, err := g.resolveModule(abs)
+		if err != nil {
+			if resolveErr == nil {
+				resolveErr = err
+			}
+			return written
+		}
+		if !filepath.IsAbs(written) && target != abs {
+			if rel, err := filepath.Rel(destDir, target); err == nil {
+				target = rel
+				if !strings.HasPrefix(rel, "..") {
+					target = "." + string(filepath.Separator) + rel
+				}
+			}
+		}
+		if filepath.Clean(target) == filepath.Clean(written) {
+			return written
+		}
+		rewritten[target] = written
+		return target
+	})
+	if resolveErr != nil {
+		return resolveErr
+	}
+	if len(rewritten) > 0 {
+		rel, err := filepath.Rel(g.genDir, dest)
+		if err != nil {
 			return err
 		}
-		return copyFile(path, dest)
+		g.modPaths[filepath.ToSlash(rel)] = rewritten
+	}
+	return os.WriteFile(dest, data, 0o644)
+}
+
+// resolveModule returns where the module directory abs lives for the
+// generated workspace: its mirror in a generated tree, a newly generated copy
+// for modules with .p.go files, or abs itself.
+func (g *generator) resolveModule(abs string) (string, error) {
+	var best *tree
+	for src, t := range g.trees {
+		if within(src, abs) && (best == nil || len(src) > len(best.src)) {
+			best = t
+		}
+	}
+	if best != nil {
+		rel, err := filepath.Rel(best.src, abs)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(best.dest, rel), nil
+	}
+	if !hasLocalizedSources(abs) {
+		return abs, nil
+	}
+	sum := sha1.Sum([]byte(abs))
+	t := &tree{
+		src:      abs,
+		dest:     filepath.Join(g.genDir, externalModulesDir, filepath.Base(abs)+"-"+hex.EncodeToString(sum[:4])),
+		maps:     g.maps,
+		external: true,
+	}
+	if g.opts.ModuleMaps != nil {
+		maps, ok, err := g.opts.ModuleMaps(abs)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", abs, err)
+		}
+		if ok {
+			t.maps = maps
+		}
+	}
+	t.maps = g.treeMaps(t.maps)
+	g.trees[abs] = t
+	return t.dest, g.generateTree(t)
+}
+
+// treeMaps returns maps with the shared Transliterator when transliteration
+// is enabled and maps has a transliteration table.
+func (g *generator) treeMaps(maps transpile.Maps) transpile.Maps {
+	if g.translit != nil && len(maps.Transliteration) > 0 {
+		maps.Transliterator = g.translit
+	}
+	return maps
+}
+
+// resolveKeywordCheck returns opts.KeywordCheck, else the keyword_check of
+// the root's pgo.json, else CheckError.
+func resolveKeywordCheck(root string, opts Options) (CheckMode, error) {
+	if opts.KeywordCheck != "" {
+		return ParseCheckMode(string(opts.KeywordCheck))
+	}
+	cfg, err := LoadConfig(root)
+	if err != nil || cfg.KeywordCheck == "" {
+		return CheckError, err
+	}
+	mode, err := ParseCheckMode(string(cfg.KeywordCheck))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", filepath.Join(root, ConfigFileName), err)
+	}
+	return mode, nil
+}
+
+// checkLocalizedKeywords applies the keyword check to the .go file rel.
+func (g *generator) checkLocalizedKeywords(rel string, src []byte, maps transpile.Maps) error {
+	if g.keywordCheck == CheckOff {
+		return nil
+	}
+	found := transpile.FindLocalizedKeywords(src, maps)
+	if len(found) == 0 {
+		return nil
+	}
+	k := found[0]
+	msg := fmt.Sprintf("%s:%d:%d: localized keyword %q (%s) in a .go file", rel, k.Line, k.Column, k.Word, k.Keyword)
+	if len(found) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(found)-1)
+	}
+	err := fmt.Errorf("%s; rename it to *.p.go so it can be transpiled, or set keyword_check in %s", msg, ConfigFileName)
+	if g.keywordCheck == CheckWarn {
+		g.warn(err)
+		return nil
+	}
+	return err
+}
+
+func (g *generator) warn(err error) {
+	if g.opts.Warn != nil {
+		g.opts.Warn(err)
+	}
+}
+
+// within reports whether path is dir or inside it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// hasLocalizedSources reports whether the tree at dir contains .p.go files.
+func hasLocalizedSources(dir string) bool {
+	found := false
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && path != dir && (d.Name() == GeneratedDirName || d.Name() == "vendor" || d.Name() == "testdata" ||
+			strings.HasPrefix(d.Name(), "_") || strings.HasPrefix(d.Name(), ".")) {
+			return fs.SkipDir
+		}
+		if strings.HasSuffix(path, ".p.go") {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
 	})
+	return found
 }
 
 func shouldIncludeLocalized(rel string, locale string) bool {
@@ -136,27 +531,6 @@ func shouldIncludeLocalized(rel string, locale string) bool {
 	return false
 }
 
-func bgToGoOutput(rel string) string {
-	if !strings.HasSuffix(rel, ".p.go") {
-		return rel
-	}
-	base := strings.TrimSuffix(rel, ".p.go")
-	return base + "_p.go"
-}
-
-func copyIfExists(src, dest string) error {
-	if _, err := os.Stat(src); err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
-	}
-	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-		return err
-	}
-	return copyFile(src, dest)
-}
-
 func copyFile(src, dest string) error {
 	s, err := os.Open(src)
 	if err != nil {
@@ -0,0 +1,229 @@
+package workspace
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmizanur/poly-go/internal/transpile"
+)
+
+// writeTree creates files (slash-separated paths → content) below root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func loadMaps(t *testing.T, locale string) transpile.Maps {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "lang", locale+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	maps, err := transpile.LoadKeywordMapData(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return maps
+}
+
+// exists reports whether the slash-separated path exists below root.
+func exists(root, name string) bool {
+	_, err := os.Stat(filepath.Join(root, filepath.FromSlash(name)))
+	return err == nil
+}
+
+func TestGenerateIgnoredDirectories(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"go.mod":       "module ex\n\ngo 1.21\n",
+		".gitignore":   "gen/\n*.log\n",
+		"main.go":      "package main\n\nimport \"ex/gen\"\n\nfunc main() { gen.F() }\n",
+		"app.log":      "log\n",
+		"gen/x.go":     "package gen\n\nimport _ \"embed\"\n\n//go:embed data.txt\nvar data string\n\nfunc F() {}\n",
+		"gen/data.txt": "embedded\n",
+		"gen/notes.md": "notes\n",
+		"gen/sub/y.s":  "\n",
+	})
+	if err := Generate(root, loadMaps(t, "bn"), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	genDir := filepath.Join(root, GeneratedDirName)
+	for name, want := range map[string]bool{
+		"main.go":      true,
+		"gen/x.go":     true,
+		"gen/data.txt": true,
+		"gen/sub/y.s":  true,
+		"gen/notes.md": false,
+		"app.log":      false,
+	} {
+		if got := exists(genDir, name); got != want {
+			t.Errorf("%s in the workspace: %v, want %v", name, got, want)
+		}
+	}
+
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = genDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go build: %v\n%s", err, out)
+	}
+}
+
+func TestGenerateKeywordCheck(t *testing.T) {
+	tests := []struct {
+		config   string // keyword_check in pgo.json
+		override CheckMode
+		err      string
+		warned   bool
+	}{
+		{config: "", err: `util.go:1:1: localized keyword "paquete" (package) in a .go file (and 1 more)`},
+		{config: "error", err: "localized keyword"},
+		{config: "warn", warned: true},
+		{config: "off"},
+		{config: "bogus", err: `invalid keyword check "bogus"`},
+		// Options win over pgo.json.
+		{config: "off", override: CheckError, err: "localized keyword"},
+		{config: "error", override: CheckWarn, warned: true},
+		{config: "bogus", override: CheckOff},
+	}
+	for _, tt := range tests {
+		root := t.TempDir()
+		files := map[string]string{
+			"go.mod":  "module ex\n\ngo 1.21\n",
+			"main.go": "package main\n\nfunc main() {}\n",
+			// A .p.go file saved under the wrong name.
+			"util.go": "paquete main\n\nfuncion f() {}\n",
+		}
+		if tt.config != "" {
+			files[ConfigFileName] = `{"keyword_check": "` + tt.config + `"}`
+		}
+		writeTree(t, root, files)
+		var warnings []error
+		opts := Options{KeywordCheck: tt.override, Warn: func(err error) { warnings = append(warnings, err) }}
+		err := Generate(root, loadMaps(t, "es"), opts)
+
+		name := tt.config + "/" + string(tt.override)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: Generate error %v, want %q", name, err, tt.err)
+		}
+		warned := false
+		for _, w := range warnings {
+			if strings.Contains(w.Error(), "localized keyword") {
+				warned = true
+			}
+		}
+		if warned != tt.warned {
+			t.Errorf("%s: warnings %v, want a keyword warning: %v", name, warnings, tt.warned)
+		}
+		if tt.err == "" && !exists(filepath.Join(root, GeneratedDirName), "util.go") {
+			t.Errorf("%s: util.go not copied", name)
+		}
+	}
+}
+
+// goCommand runs the go command in dir without the GOFLAGS of the
+// environment; -mod=mod is rejected in workspace mode.
+func goCommand(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOWORK=")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go %s in %s: %v\n%s", strings.Join(args, " "), dir, err, out)
+	}
+}
+
+// externalCopy returns the generated copy of the module outside the root
+// named base.
+func externalCopy(t *testing.T, genDir, base string) string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(genDir, externalModulesDir, base+"-*"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("generated copies of %s: %v, %v", base, matches, err)
+	}
+	return matches[0]
+}
+
+func TestGenerateWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "repo")
+	writeTree(t, dir, map[string]string{
+		"repo/go.work":       "go 1.21\n\nuse (\n\t./app\n\t../lib\n)\n",
+		"repo/app/go.mod":    "module ex/app\n\ngo 1.21\n",
+		"repo/app/main.p.go": "প্যাকেজ main\n\nআমদানি \"ex/lib\"\n\nফাংশন main() { lib.F() }\n",
+		"lib/go.mod":         "module ex/lib\n\ngo 1.21\n",
+		"lib/lib.p.go":       "প্যাকেজ lib\n\nফাংশন F() {}\n",
+	})
+	if err := Generate(root, loadMaps(t, "bn"), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	genDir := filepath.Join(root, GeneratedDirName)
+	lib := externalCopy(t, genDir, "lib")
+	if !exists(lib, "lib_p.go") {
+		t.Errorf("lib.p.go of the module outside the root was not transpiled")
+	}
+	work, err := os.ReadFile(filepath.Join(genDir, "go.work"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(genDir, lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(work), "./app") || !strings.Contains(string(work), "./"+filepath.ToSlash(rel)) {
+		t.Errorf("go.work does not use the generated modules:\n%s", work)
+	}
+	goCommand(t, filepath.Join(genDir, "app"), "build", ".")
+}
+
+func TestGenerateExternalModuleSkips(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "app")
+	bad := "not go at all {\n"
+	writeTree(t, dir, map[string]string{
+		"app/go.mod":           "module ex/app\n\ngo 1.21\n\nrequire ex/lib v0.0.0\n\nreplace ex/lib => ../lib\n",
+		"app/main.go":          "package main\n\nimport \"ex/lib\"\n\nfunc main() { lib.F() }\n",
+		"lib/go.mod":           "module ex/lib\n\ngo 1.21\n",
+		"lib/lib.p.go":         "প্যাকেজ lib\n\nফাংশন F() {}\n",
+		"lib/_draft.p.go":      bad,
+		"lib/.scratch.p.go":    bad,
+		"lib/testdata/x.p.go":  bad,
+		"lib/_tools/x.p.go":    bad,
+		"lib/.cache/x.p.go":    bad,
+		"lib/sub/testdata.txt": "kept\n",
+	})
+	var warnings []error
+	opts := Options{Warn: func(err error) { warnings = append(warnings, err) }}
+	if err := Generate(root, loadMaps(t, "bn"), opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("warnings for files the go command ignores: %v", warnings)
+	}
+	genDir := filepath.Join(root, GeneratedDirName)
+	lib := externalCopy(t, genDir, "lib")
+	for name, want := range map[string]bool{
+		"lib_p.go":         true,
+		"sub/testdata.txt": true,
+		"_draft_p.go":      false,
+		".scratch_p.go":    false,
+		"testdata":         false,
+		"_tools":           false,
+		".cache":           false,
+	} {
+		if got := exists(lib, name); got != want {
+			t.Errorf("%s in the generated copy of lib: %v, want %v", name, got, want)
+		}
+	}
+	goCommand(t, genDir, "build", ".")
+}
@@ -0,0 +1,55 @@
+package polygo_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/newmizanur/poly-go/polygo"
+)
+
+func ExampleToGo() {
+	maps, err := polygo.EmbeddedMaps("es", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src := []byte("paquete main\n\nfuncion doble(n entero) entero {\n\tretornar n * 2\n}\n")
+	out, err := polygo.ToGo("doble.p.go", src, maps)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(out))
+	// Output:
+	// package main
+	//
+	// func doble(n int) int {
+	// 	return n * 2
+	// }
+}
+
+func ExampleToLocal() {
+	maps, err := polygo.EmbeddedMaps("es", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out, err := polygo.ToLocal("main.go", []byte("package main\n\nvar listo bool = true\n"), maps)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(out))
+	// Output:
+	// paquete main
+	//
+	// var listo booleano = verdadero
+}
+
+func ExampleGoFileName() {
+	maps, err := polygo.EmbeddedMaps("bn", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(polygo.GoFileName("net/dial_linux.p.go", maps))
+	fmt.Println(polygo.GoFileName("calc_test.p.go", maps))
+	// Output:
+	// net/dial_p_linux.go
+	// calc_p_test.go
+}
@@ -0,0 +1,99 @@
+// Package pgotrace rewrites Go stack traces of programs built by pgo so that
+// they refer to the localized .p.go sources: paths inside .pgo_gen become
+// paths in the module, and generated file names and mangled identifiers
+// (Bgo_…) get their original spelling back. Line numbers need no mapping.
+//
+// pgo run --rewrite-traces does the same for any program; this package is
+// for binaries started outside pgo:
+//
+//	ফাংশন main() {
+//		স্থগিত pgotrace.Recover()
+//		...
+//	}
+//
+// The mapping is read from the .pgo_gen/.pgo_names.json file of the build, so
+// it is only available on the machine that built the program. Without it,
+// traces are returned unchanged.
+package pgotrace
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/newmizanur/poly-go/internal/workspace"
+)
+
+var (
+	replacerMu sync.Mutex
+	replacer   *workspace.Replacer
+)
+
+// Rewrite maps a stack trace, or any text mentioning generated files and
+// names, back to the localized sources.
+func Rewrite(trace []byte) []byte {
+	r := buildReplacer(string(trace))
+	if r == nil {
+		return trace
+	}
+	return []byte(r.Replace(string(trace)))
+}
+
+// buildReplacer returns the replacer of the build, loading it on first use.
+// Until a load succeeds it is tried again, since a later trace may name the
+// generated workspace when an earlier one did not.
+func buildReplacer(trace string) *workspace.Replacer {
+	replacerMu.Lock()
+	defer replacerMu.Unlock()
+	if replacer == nil {
+		replacer = loadReplacer(trace)
+	}
+	return replacer
+}
+
+// Stack is debug.Stack rewritten with Rewrite.
+func Stack() []byte {
+	return Rewrite(debug.Stack())
+}
+
+// Recover reports a panic with a rewritten stack trace and exits with status
+// 2, like an unrecovered panic. Defer it at the top of main (and of
+// goroutines that may panic); it must be deferred directly.
+func Recover() {
+	if r := recover(); r != nil {
+		stack := debug.Stack()
+		// Drop the frames of this package, down to the panic call.
+		if header := bytes.IndexByte(stack, '\n') + 1; header > 0 {
+			if idx := bytes.Index(stack, []byte("\npanic(")); idx >= header {
+				stack = append(stack[:header:header], stack[idx+1:]...)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", r, Rewrite(stack))
+		os.Exit(2)
+	}
+}
+
+// loadReplacer finds the generated workspace from the environment pgo sets
+// for programs it runs, or from the paths in trace.
+func loadReplacer(trace string) *workspace.Replacer {
+	genDir := os.Getenv("PGO_GEN_DIR")
+	if genDir == "" {
+		marker := string(filepath.Separator) + workspace.GeneratedDirName + string(filepath.Separator)
+		idx := strings.Index(trace, marker)
+		if idx < 0 {
+			return nil
+		}
+		start := strings.LastIndexAny(trace[:idx], " \t\n") + 1
+		genDir = trace[start : idx+len(marker)-1]
+	}
+	moduleRoot := filepath.Dir(genDir)
+	names, err := workspace.LoadNames(moduleRoot)
+	if err != nil {
+		return nil
+	}
+	return names.TraceReplacer(genDir, moduleRoot)
+}
@@ -0,0 +1,100 @@
+package pgotrace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmizanur/poly-go/internal/workspace"
+)
+
+// namesFile is where Generate records the names of a workspace.
+const namesFile = ".pgo_names.json"
+
+// writeNames creates a module with a generated workspace holding a names
+// file, and returns the workspace directory.
+func writeNames(t *testing.T) string {
+	t.Helper()
+	genDir := filepath.Join(t.TempDir(), workspace.GeneratedDirName)
+	if err := os.Mkdir(genDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	names := `{
+  "files": {"main_p.go": "main.p.go", "util_p.go": "util.p.go"},
+  "idents": {"Bgo_5Ywg": "যোগ", "TestSum": "পরীক্ষাযোগ"}
+}`
+	if err := os.WriteFile(filepath.Join(genDir, namesFile), []byte(names), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return genDir
+}
+
+func resetReplacer(t *testing.T) {
+	replacer = nil
+	t.Cleanup(func() { replacer = nil })
+}
+
+func TestRewrite(t *testing.T) {
+	resetReplacer(t)
+	t.Setenv("PGO_GEN_DIR", "")
+	genDir := writeNames(t)
+	moduleRoot := filepath.Dir(genDir)
+
+	// Nothing names the workspace yet; that must not disable later calls.
+	plain := "goroutine 1 [running]:\nmain.Bgo_5Ywg()\n"
+	if got := string(Rewrite([]byte(plain))); got != plain {
+		t.Errorf("Rewrite without a workspace = %q", got)
+	}
+
+	trace := "panic: boom\n\ngoroutine 1 [running]:\nmain.Bgo_5Ywg(...)\n\t" +
+		filepath.Join(genDir, "main_p.go") + ":12 +0x1d\nmain.TestSum()\n\t" +
+		filepath.Join(genDir, "util_p.go") + ":3\n"
+	want := "panic: boom\n\ngoroutine 1 [running]:\nmain.যোগ(...)\n\t" +
+		filepath.Join(moduleRoot, "main.p.go") + ":12 +0x1d\nmain.পরীক্ষাযোগ()\n\t" +
+		filepath.Join(moduleRoot, "util.p.go") + ":3\n"
+	if got := string(Rewrite([]byte(trace))); got != want {
+		t.Errorf("Rewrite:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Once loaded, the mapping also applies to text without paths.
+	if got := string(Rewrite([]byte(plain))); got != "goroutine 1 [running]:\nmain.যোগ()\n" {
+		t.Errorf("Rewrite after loading = %q", got)
+	}
+}
+
+func TestRewriteFromEnvironment(t *testing.T) {
+	resetReplacer(t)
+	genDir := writeNames(t)
+	t.Setenv("PGO_GEN_DIR", genDir)
+
+	got := string(Rewrite([]byte("main.Bgo_5Ywg()\n\tmain_p.go:4\n")))
+	if want := "main.যোগ()\n\tmain.p.go:4\n"; got != want {
+		t.Errorf("Rewrite = %q, want %q", got, want)
+	}
+	if !strings.Contains(string(Stack()), "TestRewriteFromEnvironment") {
+		t.Error("Stack lost the frames of its caller")
+	}
+}
+
+func TestRewriteWithoutNames(t *testing.T) {
+	resetReplacer(t)
+	genDir := filepath.Join(t.TempDir(), workspace.GeneratedDirName)
+	t.Setenv("PGO_GEN_DIR", "")
+
+	trace := "main.Bgo_5Ywg()\n\t" + filepath.Join(genDir, "main_p.go") + ":4\n"
+	if got := string(Rewrite([]byte(trace))); got != trace {
+		t.Errorf("Rewrite without a names file = %q", got)
+	}
+
+	// The names file may appear later, e.g. after the next build.
+	if err := os.Mkdir(genDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(genDir, namesFile), []byte(`{"idents": {"Bgo_5Ywg": "যোগ"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(Rewrite([]byte(trace))); !strings.HasPrefix(got, "main.যোগ()\n") {
+		t.Errorf("Rewrite after the names file appeared = %q", got)
+	}
+}
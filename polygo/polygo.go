@@ -0,0 +1,440 @@
+// Package polygo is the public Go API of PolyGo: loading keyword maps,
+// transpiling between localized .p.go sources and Go, generating the
+// .pgo_gen workspace and mapping generated positions back to the sources.
+//
+// The pgo command is a thin client of this package. From v1.0.0 on, the
+// exported API follows semantic versioning: it only changes incompatibly
+// with a new major version. Types re-exported from internal packages are
+// covered by the same guarantee for the fields and methods they expose.
+package polygo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/newmizanur/poly-go/internal/transpile"
+	"github.com/newmizanur/poly-go/internal/workspace"
+)
+
+// DefaultLocale is used when no locale is configured.
+const DefaultLocale = transpile.DefaultLocale
+
+// GeneratedDirName is the workspace directory created at the module root.
+const GeneratedDirName = workspace.GeneratedDirName
+
+// Maps is a loaded keyword map.
+type Maps = transpile.Maps
+
+// Direction is the direction of a transpilation.
+type Direction = transpile.Direction
+
+const (
+	LocalToGo     = transpile.LocalToGo
+	GoToLocal     = transpile.GoToLocal
+	AutoDirection = transpile.AutoDirection
+)
+
+// GenerateOptions control Generate.
+type GenerateOptions = workspace.Options
+
+// LoadMaps reads a keyword map file. allowGo permits Go keywords in .p.go
+// sources.
+func LoadMaps(path string, allowGo bool) (Maps, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Maps{}, err
+	}
+	return transpile.LoadKeywordMapData(data, allowGo)
+}
+
+// LoadMapsData parses keyword map JSON.
+func LoadMapsData(data []byte, allowGo bool) (Maps, error) {
+	return transpile.LoadKeywordMapData(data, allowGo)
+}
+
+// EmbeddedMaps loads one of the keyword maps built into PolyGo. An empty
+// locale selects DefaultLocale.
+func EmbeddedMaps(locale string, allowGo bool) (Maps, error) {
+	data, ok := transpile.EmbeddedKeywordMap(locale)
+	if !ok {
+		return Maps{}, fmt.Errorf("no embedded keyword map for locale %q", locale)
+	}
+	return transpile.LoadKeywordMapData(data, allowGo)
+}
+
+// Locales lists the embedded locales.
+func Locales() []string {
+	return transpile.EmbeddedLocales()
+}
+
+// ResolveLocale returns the locale for moduleRoot: flag if set, then the
+// PGO_LANG, POLYGO_LANG and BGO_LANG environment variables, then the
+// .pgo_lang file. An empty result means the default map.
+func ResolveLocale(moduleRoot, flag string) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+	for _, name := range []string{"PGO_LANG", "POLYGO_LANG", "BGO_LANG"} {
+		if env := strings.TrimSpace(os.Getenv(name)); env != "" {
+			return env, nil
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(moduleRoot, ".pgo_lang"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ModuleMaps loads the keyword map used for moduleRoot, following the same
+// rules as the pgo command: an explicit mapPath wins, then moduleRoot/lang,
+// then the embedded maps. It also returns the resolved locale.
+func ModuleMaps(moduleRoot, locale, mapPath string, allowGo bool) (Maps, string, error) {
+	resolved, err := ResolveLocale(moduleRoot, locale)
+	if err != nil {
+		return Maps{}, "", err
+	}
+	if mapPath != "" {
+		maps, err := LoadMaps(mapPath, allowGo)
+		return maps, resolved, err
+	}
+	data, err := keywordMapData(moduleRoot, resolved)
+	if err != nil {
+		return Maps{}, "", err
+	}
+	maps, err := transpile.LoadKeywordMapData(data, allowGo)
+	return maps, resolved, err
+}
+
+func keywordMapData(moduleRoot, locale string) ([]byte, error) {
+	if locale != "" {
+		if data, err := os.ReadFile(filepath.Join(moduleRoot, "lang", locale+".json")); err == nil {
+			return data, nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if data, ok := transpile.EmbeddedKeywordMap(locale); ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("keyword map for lang %q not found (moduleRoot/lang or embedded)", locale)
+	}
+	if data, err := os.ReadFile(filepath.Join(moduleRoot, "keywords.json")); err == nil {
+		return data, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if data, ok := transpile.EmbeddedKeywordMap(DefaultLocale); ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("no embedded keyword maps found")
+}
+
+// LocaleAvailable reports whether locale has a map in moduleRoot/lang or
+// among the embedded maps.
+func LocaleAvailable(moduleRoot, locale string) bool {
+	if locale == "" {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(moduleRoot, "lang", locale+".json")); err == nil {
+		return true
+	}
+	_, ok := transpile.EmbeddedKeywordMap(locale)
+	return ok
+}
+
+// ToGo transpiles a localized .p.go source into Go, exactly as Generate
+// does. path is only used for file-name rules (test files, suffixes) and
+// error messages.
+func ToGo(path string, src []byte, maps Maps) ([]byte, error) {
+	return transpile.TranspileFileLocalizedToGo(path, src, maps)
+}
+
+// ToLocal transpiles Go source into localized source.
+func ToLocal(path string, src []byte, maps Maps) ([]byte, error) {
+	return transpile.TranspileFileGoToLocal(path, src, maps)
+}
+
+// Transpile detects the direction of src and transpiles it. Input that
+// mixes both languages is an error (see DetectDirection).
+func Transpile(path string, src []byte, maps Maps) ([]byte, error) {
+	return transpile.TranspileFile(path, src, maps, AutoDirection)
+}
+
+// TranspileDirection transpiles src in the given direction, like ToGo or
+// ToLocal; AutoDirection makes it behave like Transpile.
+func TranspileDirection(path string, src []byte, maps Maps, direction Direction) ([]byte, error) {
+	return transpile.TranspileFile(path, src, maps, direction)
+}
+
+// Detection is the result of DetectDirection.
+type Detection = transpile.Detection
+
+// DetectDirection scores the Go and localized words of src and returns the
+// likelier direction with its confidence. It fails when src has evidence for
+// both and the confidence is below 0.8.
+func DetectDirection(src []byte, maps Maps) (Detection, error) {
+	return transpile.DetectDirection(src, maps)
+}
+
+// TranspileStream transpiles src in the given direction and writes the
+// result to dst, like ToGo and ToLocal but without holding the whole file in
+// memory. path is used as in ToGo.
+func TranspileStream(dst io.Writer, src io.Reader, path string, maps Maps, direction Direction) error {
+	return transpile.TranspileStream(dst, src, path, maps, direction)
+}
+
+// GoFileName returns the name Generate uses for the Go file transpiled from
+// a .p.go path; other paths are returned unchanged.
+func GoFileName(path string, maps Maps) string {
+	return transpile.GoFileName(path, maps)
+}
+
+// FindModuleRoot walks up from dir to the nearest directory with a go.mod.
+func FindModuleRoot(dir string) (string, error) {
+	return workspace.FindModuleRoot(dir)
+}
+
+// FindRoot returns the directory the pgo command works on from dir: the
+// directory of the go.work file the go command would use (GOWORK is
+// honored), or else the nearest module root. Every function taking a
+// moduleRoot accepts such a directory.
+func FindRoot(dir string) (string, error) {
+	return workspace.FindRoot(dir)
+}
+
+// ModulePath returns the module path declared in go.mod data, or "".
+func ModulePath(goMod []byte) string {
+	return workspace.ModulePath(goMod)
+}
+
+// Generate recreates the .pgo_gen workspace of moduleRoot. Nested modules and
+// go.work files are mirrored; modules outside moduleRoot that go.mod or
+// go.work refer to by path are generated too when they contain .p.go files.
+// Files matched by .gitignore, .pgoignore or the excludes of pgo.json are
+// left out, except Go sources, testdata and //go:embed targets.
+// Unless opts.ModuleMaps is set, such a module is transpiled with its own map
+// when it selects one (.pgo_lang or keywords.json), and with maps otherwise.
+func Generate(moduleRoot string, maps Maps, opts GenerateOptions) error {
+	if opts.ModuleMaps == nil {
+		opts.ModuleMaps = declaredMaps
+	}
+	return workspace.Generate(moduleRoot, maps, opts)
+}
+
+// declaredMaps loads the map a module selects in its own tree. Environment
+// variables and flags only apply to the module pgo is run in.
+func declaredMaps(moduleDir string) (Maps, bool, error) {
+	locale := ""
+	if data, err := os.ReadFile(filepath.Join(moduleDir, ".pgo_lang")); err == nil {
+		locale = strings.TrimSpace(string(data))
+	} else if !os.IsNotExist(err) {
+		return Maps{}, false, err
+	}
+	if locale == "" {
+		if _, err := os.Stat(filepath.Join(moduleDir, "keywords.json")); err != nil {
+			return Maps{}, false, nil
+		}
+	}
+	data, err := keywordMapData(moduleDir, locale)
+	if err != nil {
+		return Maps{}, false, err
+	}
+	maps, err := transpile.LoadKeywordMapData(data, false)
+	return maps, err == nil, err
+}
+
+// ConfigFileName is the optional configuration file at the module root.
+const ConfigFileName = workspace.ConfigFileName
+
+// Config is the content of ConfigFileName.
+type Config = workspace.Config
+
+// LoadConfig reads the pgo.json of moduleRoot; a missing file yields an empty
+// Config.
+func LoadConfig(moduleRoot string) (Config, error) {
+	return workspace.LoadConfig(moduleRoot)
+}
+
+// CheckMode says what Generate does with .go files that use localized
+// keywords; see GenerateOptions.KeywordCheck and Config.KeywordCheck.
+type CheckMode = workspace.CheckMode
+
+const (
+	CheckError = workspace.CheckError
+	CheckWarn  = workspace.CheckWarn
+	CheckOff   = workspace.CheckOff
+)
+
+// ParseCheckMode validates a CheckMode given by name.
+func ParseCheckMode(s string) (CheckMode, error) {
+	return workspace.ParseCheckMode(s)
+}
+
+// TranslitFileName keeps the Latin names given to non-ASCII identifiers when
+// transliteration is enabled (Config.Transliterate or
+// GenerateOptions.Transliterate). It belongs under version control.
+const TranslitFileName = workspace.TranslitFileName
+
+// Transliterator gives non-ASCII identifiers Latin names; see
+// Maps.Transliterator.
+type Transliterator = transpile.Transliterator
+
+// WithTransliteration returns maps with a Transliterator loaded from the
+// TranslitFileName of moduleRoot when transliteration is enabled there, and
+// maps otherwise. Names it hands out for new identifiers are not saved; only
+// Generate and GenerateInPlace update the file.
+func WithTransliteration(moduleRoot string, maps Maps, opts GenerateOptions) (Maps, error) {
+	return workspace.WithTransliteration(moduleRoot, maps, opts)
+}
+
+// PublishTag is the build tag that published .p.go sources require and the
+// Go files of GenerateInPlace exclude; see GenerateInPlace.
+const PublishTag = workspace.PublishTag
+
+// InPlaceChange is a file GenerateInPlace wrote or removed, or CheckInPlace
+// found out of date.
+type InPlaceChange = workspace.InPlaceChange
+
+// GenerateInPlace writes the Go translation of every .p.go file below
+// moduleRoot next to its source (x.p.go → x_p.go), so the module can be
+// published for users of the plain go command. Outputs carry a generated-code
+// header and //go:build !polygo; sources without a build constraint get
+// //go:build polygo so the go command skips them. pgo itself always builds
+// from the .p.go files.
+func GenerateInPlace(moduleRoot string, maps Maps, opts GenerateOptions) ([]InPlaceChange, error) {
+	return workspace.GenerateInPlace(moduleRoot, maps, opts, false)
+}
+
+// CheckInPlace reports, without writing anything, the outputs of
+// GenerateInPlace that are missing, stale for the current sources and map,
+// or orphaned, and sources that lack the polygo constraint.
+func CheckInPlace(moduleRoot string, maps Maps, opts GenerateOptions) ([]InPlaceChange, error) {
+	return workspace.GenerateInPlace(moduleRoot, maps, opts, true)
+}
+
+// Snapshot records the files of a generated workspace; see SyncBack.
+type Snapshot = workspace.Snapshot
+
+// TakeSnapshot records the current files of the workspace of moduleRoot.
+func TakeSnapshot(moduleRoot string) (Snapshot, error) {
+	return workspace.TakeSnapshot(moduleRoot)
+}
+
+// SyncBack copies files that go commands created or changed in the workspace
+// since before (go generate outputs, go.mod and go.sum after go mod tidy)
+// back into moduleRoot. It returns the copied paths, relative to moduleRoot.
+func SyncBack(moduleRoot string, before Snapshot) ([]string, error) {
+	return workspace.SyncBack(moduleRoot, before)
+}
+
+// Clean removes the .pgo_gen workspace of moduleRoot.
+func Clean(moduleRoot string) error {
+	return os.RemoveAll(filepath.Join(moduleRoot, GeneratedDirName))
+}
+
+// Position is a location in a source file. Line and Column are 1-based;
+// Column counts bytes.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// OriginalPosition maps a position in a file of the generated workspace of
+// moduleRoot back to the source it was produced from. Transpiling keeps lines
+// one to one; the column is mapped through the source map written by
+// Generate. Positions outside the workspace are returned unchanged with
+// ok == false.
+func OriginalPosition(moduleRoot string, pos Position) (orig Position, ok bool) {
+	genDir := filepath.Join(moduleRoot, GeneratedDirName)
+	rel, err := filepath.Rel(genDir, pos.File)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return pos, false
+	}
+	orig = pos
+	orig.File = filepath.Join(moduleRoot, rel)
+	if m, err := LoadSourceMap(moduleRoot); err == nil {
+		if source, column, ok := m.Original(filepath.ToSlash(rel), pos.Line, pos.Column); ok {
+			orig.File = filepath.Join(moduleRoot, filepath.FromSlash(source))
+			orig.Column = column
+		}
+	}
+	return orig, true
+}
+
+// GeneratedPosition maps a position in a .p.go source of moduleRoot to the
+// Go file Generate produced from it. Other positions are returned unchanged
+// with ok == false.
+func GeneratedPosition(moduleRoot string, pos Position) (gen Position, ok bool) {
+	rel, err := filepath.Rel(moduleRoot, pos.File)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return pos, false
+	}
+	m, err := LoadSourceMap(moduleRoot)
+	if err != nil {
+		return pos, false
+	}
+	file, column, ok := m.Generated(filepath.ToSlash(rel), pos.Line, pos.Column)
+	if !ok {
+		return pos, false
+	}
+	gen = pos
+	gen.File = filepath.Join(moduleRoot, GeneratedDirName, filepath.FromSlash(file))
+	gen.Column = column
+	return gen, true
+}
+
+// CoverProfileToSource rewrites a coverage profile produced in the generated
+// workspace of moduleRoot to refer to the .p.go sources, with columns mapped
+// through the source map. Blocks of other files are kept as they are.
+func CoverProfileToSource(moduleRoot string, profile []byte) ([]byte, error) {
+	return workspace.RewriteCoverProfile(moduleRoot, profile, false)
+}
+
+// CoverProfileToGenerated is the inverse of CoverProfileToSource.
+func CoverProfileToGenerated(moduleRoot string, profile []byte) ([]byte, error) {
+	return workspace.RewriteCoverProfile(moduleRoot, profile, true)
+}
+
+// SourceMap records where generated Go files differ from their .p.go
+// sources; see LoadSourceMap.
+type SourceMap = workspace.SourceMap
+
+// LoadSourceMap reads the source map written by the last Generate of
+// moduleRoot (.pgo_gen/.pgo_sourcemap.json).
+func LoadSourceMap(moduleRoot string) (SourceMap, error) {
+	return workspace.LoadSourceMap(moduleRoot)
+}
+
+// Names maps generated file names and identifiers back to their localized
+// spelling; see LoadNames.
+type Names = workspace.Names
+
+// Replacer rewrites whole generated names in tool output; see
+// Names.Replacer.
+type Replacer = workspace.Replacer
+
+// LoadNames reads the names recorded by the last Generate of moduleRoot.
+func LoadNames(moduleRoot string) (Names, error) {
+	return workspace.LoadNames(moduleRoot)
+}
+
+// OriginalName returns the localized spelling of an identifier that only
+// exists in the generated workspace (mangled names, test functions).
+func OriginalName(moduleRoot, name string) (string, bool) {
+	names, err := LoadNames(moduleRoot)
+	if err != nil {
+		return name, false
+	}
+	orig, ok := names.Idents[name]
+	if !ok {
+		return name, false
+	}
+	return orig, true
+}
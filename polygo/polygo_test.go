@@ -0,0 +1,48 @@
+package polygo_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/newmizanur/poly-go/polygo"
+)
+
+// Modules outside the root are transpiled with the map they select, or with
+// the root's map when they select none.
+func TestGenerateModuleMaps(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app/go.mod":    "module ex/app\n\ngo 1.21\n\nrequire (\n\tex/es v0.0.0\n\tex/bn v0.0.0\n)\n\nreplace ex/es => ../es\n\nreplace ex/bn => ../bn\n",
+		"app/main.p.go": "প্যাকেজ main\n\nআমদানি (\n\t\"ex/bn\"\n\t\"ex/es\"\n)\n\nফাংশন main() { es.F(); bn.F() }\n",
+		"es/go.mod":     "module ex/es\n\ngo 1.21\n",
+		"es/.pgo_lang":  "es\n",
+		"es/es.p.go":    "paquete es\n\nfuncion F() {}\n",
+		"bn/go.mod":     "module ex/bn\n\ngo 1.21\n",
+		"bn/bn.p.go":    "প্যাকেজ bn\n\nফাংশন F() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	maps, err := polygo.EmbeddedMaps("bn", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "app")
+	if err := polygo.Generate(root, maps, polygo.GenerateOptions{Warn: func(err error) { t.Error(err) }}); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "build", ".")
+	cmd.Dir = filepath.Join(root, polygo.GeneratedDirName)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go build: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+)
+
+//go:embed config.json
+var Bgo_abb3f6872ccaf9c8 []byte
+
+//go:generate stringer -type=রং
+type Bgo_41e2aa806d9d2033 int
+
+type Bgo_11dbc562ff031080 struct {
+	Bgo_56c1490dee7a4d1c string `json:"নাম,omitempty" xml:"name"`
+	Bgo_fc09c57c56694c5b int `db:"age"`
+	Bgo_77102065914d8bb7 string `এটা জেসন:নয়`
+}
+
+func main() {
+	// //pgo:এম্বেড inside a comment body is left alone
+	fmt.Println("//pgo:এম্বেড", `জেসন:"নাম"`, len(Bgo_abb3f6872ccaf9c8))
+}
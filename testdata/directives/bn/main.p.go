@@ -0,0 +1,23 @@
+প্যাকেজ main
+
+আমদানি (
+	_ "embed"
+	"fmt"
+)
+
+//pgo:এম্বেড config.json
+চলক কনফিগ []বাইট
+
+//pgo:জেনারেট stringer -type=রং
+ধরণ রং পূর্ণসংখ্যা
+
+ধরণ ব্যক্তি কাঠামো {
+	নাম লেখা `জেসন:"নাম,omitempty" এক্সএমএল:"name"`
+	বয়স পূর্ণসংখ্যা `db:"age"`
+	মন্তব্য লেখা `এটা জেসন:নয়`
+}
+
+ফাংশন main() {
+	// //pgo:এম্বেড inside a comment body is left alone
+	fmt.Println("//pgo:এম্বেড", `জেসন:"নাম"`, দৈর্ঘ্য(কনফিগ))
+}
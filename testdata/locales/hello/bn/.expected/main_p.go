@@ -4,6 +4,6 @@ import "fmt"
 
 // এই মন্তব্যে যদি/ফাংশন/চলক লিখলেও বদলাবে না
 func main() {
-    var বার্তা string = "স্ট্রিংয়ের ভিতরে যদি, চলক, ফাংশন থাকবে কিন্তু বদলাবে না"
-    fmt.Println(বার্তা)
+    var Bgo_b21deb3d7aadb84c string = "স্ট্রিংয়ের ভিতরে যদি, চলক, ফাংশন থাকবে কিন্তু বদলাবে না"
+    fmt.Println(Bgo_b21deb3d7aadb84c)
 }
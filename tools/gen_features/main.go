@@ -42,7 +42,7 @@ func main() {
 			fatal(err)
 		}
 
-		localized, err := transpile.TranspileFile(templatePath, input, maps)
+		localized, err := transpile.TranspileFile(templatePath, input, maps, transpile.GoToLocal)
 		if err != nil {
 			fatal(err)
 		}